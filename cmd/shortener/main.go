@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/analytics"
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/blocklist"
+	"github.com/AvdeevK/url-cutter.git/internal/deletion"
 	"github.com/AvdeevK/url-cutter.git/internal/handlers"
 	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/policy"
 	"github.com/AvdeevK/url-cutter.git/internal/postgres"
+	"github.com/AvdeevK/url-cutter.git/internal/shortcode"
+	"github.com/AvdeevK/url-cutter.git/internal/sqlite"
 	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/AvdeevK/url-cutter.git/internal/threats"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/AvdeevK/url-cutter.git/internal/config"
 	"github.com/go-chi/chi/v5"
@@ -45,9 +60,8 @@ func gzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func run(r chi.Router) error {
-	logger.Log.Info("Running server", zap.String("address", config.Configs.RequestAddress))
-
+func registerRoutes(r chi.Router) {
+	r.Use(handlers.APIKeyAuth)
 	r.MethodNotAllowed(logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.NotAllowedMethodsHandler))))
 	r.Post("/", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.PostURLHandler))))
 	r.Get("/ping", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.PingDBHandler))))
@@ -56,7 +70,67 @@ func run(r chi.Router) error {
 	r.Post("/api/shorten/batch", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.PostBatchURLHandler))))
 	r.Get("/api/user/urls", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.GetAllUserURLsHandler))))
 	r.Delete("/api/user/urls", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.DeleteUserURLsHandler))))
-	return http.ListenAndServe(config.Configs.RequestAddress, r)
+	r.Post("/api/user/urls/restore", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.RestoreUserURLsHandler))))
+	r.Get("/api/user/urls/{short}/stats", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.GetURLStatsHandler))))
+	r.Get("/api/admin/cache", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.GetCacheStatsHandler))))
+	r.Post("/api/admin/purge", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.PurgeDeletedURLsHandler))))
+	r.Get("/api/user/jobs/{id}", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.GetDeletionJobHandler))))
+	r.Post("/api/user/register", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.RegisterHandler))))
+	r.Post("/api/user/login", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.LoginHandler))))
+	r.Get("/api/user/oidc/login", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.OIDCLoginHandler))))
+	r.Get("/api/user/oidc/callback", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.OIDCCallbackHandler))))
+	r.Post("/api/user/logout", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.LogoutHandler))))
+	r.Post("/api/user/keys", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.CreateAPIKeyHandler))))
+	r.Get("/api/user/keys", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.ListAPIKeysHandler))))
+	r.Delete("/api/user/keys/{id}", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.RevokeAPIKeyHandler))))
+	r.Post("/api/admin/urls/{short}/block", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.BlockURLHandler))))
+	r.Delete("/api/admin/urls/{short}/block", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.UnblockURLHandler))))
+	r.Get("/api/admin/audit", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.GetAuditHandler))))
+	r.Delete("/api/admin/urls/{short}/flag", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.UnflagURLHandler))))
+	r.Post("/api/admin/policy/reload", logger.RequestLogger(logger.ResponseLogger(gzipMiddleware(handlers.ReloadPolicyHandler))))
+}
+
+// reservedPrefixes возвращает первые сегменты статических маршрутов: код с таким
+// именем перекрыл бы маршрут.
+func reservedPrefixes(r chi.Routes) ([]string, error) {
+	var prefixes []string
+	err := chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if prefix != "" && !strings.Contains(prefix, "{") {
+			prefixes = append(prefixes, prefix)
+		}
+		return nil
+	})
+	return prefixes, err
+}
+
+func run(ctx context.Context, r chi.Router) error {
+	logger.Log.Info("Running server", zap.String("address", config.Configs.RequestAddress))
+
+	srv := &http.Server{
+		Addr:    config.Configs.RequestAddress,
+		Handler: r,
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+
+		logger.Log.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Configs.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("error of server shutdown", zap.Error(err))
+		}
+	}()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// Дожидаемся завершения обработки текущих запросов.
+	<-shutdownDone
+	return nil
 }
 
 func main() {
@@ -64,13 +138,75 @@ func main() {
 	var err error
 
 	config.ParseFlags()
+	if err := handlers.ValidateRedirectCode(config.Configs.RedirectCode); err != nil {
+		log.Fatalf("Invalid redirect config: %v", err)
+	}
+	trustedProxies, err := handlers.ParseTrustedProxies(config.Configs.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid proxy config: %v", err)
+	}
+	handlers.InitializeTrustedProxies(trustedProxies)
 
-	var storageType storage.Storage
+	var (
+		storageType storage.Storage
+		fileStorage *storage.FileStorage
+	)
 
 	if err = logger.Initialize("Info"); err != nil {
 		panic(err)
 	}
 
+	sameSite, err := auth.ParseSameSite(config.Configs.CookieSameSite)
+	if err != nil {
+		log.Fatalf("Invalid cookie config: %v", err)
+	}
+	if sameSite == http.SameSiteNoneMode && !config.Configs.CookieSecure {
+		log.Fatalf("Invalid cookie config: SameSite=None requires secure cookie")
+	}
+	if config.Configs.SessionLifetime <= 0 {
+		log.Fatalf("Invalid cookie config: session lifetime must be positive")
+	}
+	auth.InitializeCookie(auth.CookieOptions{
+		Lifetime: config.Configs.SessionLifetime,
+		Secure:   config.Configs.CookieSecure,
+		SameSite: sameSite,
+		Domain:   config.Configs.CookieDomain,
+	})
+
+	keyring, err := auth.NewKeyring(auth.KeyringOptions{
+		Path:   config.Configs.AuthKeysPath,
+		Keys:   config.Configs.AuthKeys,
+		Secret: config.Configs.AuthSecret,
+		Dev:    config.Configs.AuthDevKeys,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load auth keys: %v", err)
+	}
+	auth.InitializeKeyring(keyring)
+	logger.Log.Info("auth keys loaded", zap.String("active", keyring.ActiveKeyID()))
+
+	if config.Configs.OIDCIssuerURL != "" {
+		redirectURL := config.Configs.OIDCRedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimSuffix(config.Configs.ResponseAddress, "/") + "/api/user/oidc/callback"
+		}
+		discoveryCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := auth.NewOIDCProvider(discoveryCtx, auth.OIDCConfig{
+			IssuerURL:    config.Configs.OIDCIssuerURL,
+			ClientID:     config.Configs.OIDCClientID,
+			ClientSecret: config.Configs.OIDCClientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       strings.Fields(config.Configs.OIDCScopes),
+			HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		})
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to configure oidc provider: %v", err)
+		}
+		handlers.InitializeOIDC(provider)
+		logger.Log.Info("oidc sign in enabled", zap.String("issuer", config.Configs.OIDCIssuerURL))
+	}
+
 	if config.Configs.DatabaseAddress != "" {
 		handlers.DB, err = sql.Open("pgx", config.Configs.DatabaseAddress)
 		if err != nil {
@@ -87,13 +223,33 @@ func main() {
 		if err := postgres.RunMigrations(handlers.DB, migrationsDir); err != nil {
 			log.Fatalf("Failed to create table: %v", err)
 		}
+	} else if config.Configs.SQLitePath != "" {
+		sqliteDB, err := sqlite.Open(config.Configs.SQLitePath)
+		if err != nil {
+			log.Fatalf("Error opening sqlite database: %v", err)
+		}
+		defer sqliteDB.Close()
+
+		_, b, _, _ := runtime.Caller(0)
+		migrationsDir := filepath.Join(filepath.Dir(b), "../../internal/sqlite/migrations")
+		if err := sqlite.RunMigrations(sqliteDB, migrationsDir); err != nil {
+			log.Fatalf("Failed to create table: %v", err)
+		}
+
+		storageType = storage.NewSQLiteStorage(sqliteDB)
+		logger.Log.Info("Connection to sqlite with", zap.String("path", config.Configs.SQLitePath))
 	} else if config.Configs.FileStoragePath != "" {
 		// Если есть путь к файлу, используем файл
-		fs, err := storage.NewFileStorage(config.Configs.FileStoragePath)
+		syncPolicy, err := storage.ParseSyncPolicy(config.Configs.FileSyncPolicy)
+		if err != nil {
+			log.Fatalf("Invalid file storage config: %v", err)
+		}
+		fs, err := storage.NewFileStorage(config.Configs.FileStoragePath, syncPolicy)
 		if err != nil {
 			log.Fatalf("Failed to initialize file storage: %v", err)
 		}
 		storageType = fs
+		fileStorage = fs
 		storageName, _ := fs.GetStorageName()
 		logger.Log.Info(fmt.Sprintf("initialized %s", storageName))
 
@@ -104,9 +260,144 @@ func main() {
 		logger.Log.Info(fmt.Sprintf("initialized %s", storageName))
 	}
 
+	if config.Configs.CacheSize > 0 {
+		storageType = storage.NewCachedStorage(storageType, config.Configs.CacheSize,
+			config.Configs.CacheTTL, config.Configs.CacheNegativeTTL)
+	}
 	handlers.InitializeStorage(storageType)
 
-	if err := run(r); err != nil {
+	codes, err := shortcode.New(shortcode.Options{
+		Strategy:       config.Configs.CodeStrategy,
+		Alphabet:       config.Configs.CodeAlphabet,
+		Length:         config.Configs.CodeLength,
+		ObfuscationKey: config.Configs.CodeObfuscationKey,
+	}, storageType)
+	if err != nil {
+		log.Fatalf("Invalid short code config: %v", err)
+	}
+
+	blocked := blocklist.New()
+	if config.Configs.BlocklistPath != "" {
+		if blocked, err = blocklist.Load(config.Configs.BlocklistPath); err != nil {
+			log.Fatalf("Failed to load blocklist: %v", err)
+		}
+	}
+	registerRoutes(r)
+	prefixes, err := reservedPrefixes(r)
+	if err != nil {
+		log.Fatalf("Failed to collect reserved routes: %v", err)
+	}
+	blocked.Reserve(prefixes...)
+	handlers.InitializeBlocklist(blocked)
+	handlers.InitializeCodeGenerator(shortcode.WithFilter(codes, blocked))
+
+	destinations := policy.New()
+	if config.Configs.DomainPolicyPath != "" {
+		if destinations, err = policy.Load(config.Configs.DomainPolicyPath); err != nil {
+			log.Fatalf("Failed to load domain policy: %v", err)
+		}
+	}
+	audit, err := policy.NewAudit(config.Configs.AuditBufferSize, config.Configs.AuditLogPath)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer audit.Close()
+	handlers.InitializePolicy(destinations, audit)
+
+	scanner := threats.New()
+	if config.Configs.ThreatListPath != "" {
+		if scanner, err = threats.Load(config.Configs.ThreatListPath); err != nil {
+			log.Fatalf("Failed to load threat list: %v", err)
+		}
+	}
+	handlers.InitializeThreatScanner(scanner)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+
+	clickRecorder := analytics.NewRecorder(storageType, config.Configs.ClickBufferSize, config.Configs.ClickFlushInterval)
+	handlers.InitializeClickRecorder(clickRecorder)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		clickRecorder.Run(backgroundCtx)
+	}()
+
+	if config.Configs.JanitorInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			storage.RunJanitor(backgroundCtx, storageType, config.Configs.JanitorInterval)
+		}()
+	}
+
+	if config.Configs.DomainPolicyPath != "" && config.Configs.DomainPolicyInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			destinations.Watch(backgroundCtx, config.Configs.DomainPolicyInterval)
+		}()
+	}
+
+	if config.Configs.ThreatListPath != "" && config.Configs.ThreatListInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			scanner.Watch(backgroundCtx, config.Configs.ThreatListInterval)
+		}()
+	}
+
+	if config.Configs.AuthKeysPath != "" && config.Configs.AuthKeysInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			keyring.Watch(backgroundCtx, config.Configs.AuthKeysInterval)
+		}()
+	}
+
+	if config.Configs.PurgeInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			storage.RunPurger(backgroundCtx, storageType, config.Configs.PurgeInterval, config.Configs.RestoreWindow)
+		}()
+	}
+
+	if fileStorage != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fileStorage.RunMaintenance(backgroundCtx, config.Configs.FileSyncInterval, config.Configs.FileCompactInterval)
+		}()
+	}
+
+	deletionQueue, err := deletion.NewQueue(storageType, config.Configs.DeleteQueueSize,
+		config.Configs.DeleteBatchSize, config.Configs.DeleteFlushInterval, config.Configs.DeleteJobRetention)
+	if err != nil {
+		log.Fatalf("Invalid deletion queue config: %v", err)
+	}
+	handlers.InitializeDeletionQueue(deletionQueue)
+	go deletionQueue.Run()
+
+	if err := run(ctx, r); err != nil {
 		panic(err)
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Configs.ShutdownTimeout)
+	defer cancel()
+	if err := deletionQueue.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Error("deletion queue was not drained", zap.Error(err))
+	}
+
+	cancelBackground()
+	background.Wait()
+
+	if fileStorage != nil {
+		if err := fileStorage.Close(); err != nil {
+			logger.Log.Error("failed to close file storage", zap.Error(err))
+		}
+	}
 }
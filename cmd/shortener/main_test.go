@@ -1,18 +1,42 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/analytics"
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/auth/oidctest"
+	"github.com/AvdeevK/url-cutter.git/internal/blocklist"
 	"github.com/AvdeevK/url-cutter.git/internal/handlers"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/policy"
+	"github.com/AvdeevK/url-cutter.git/internal/shortcode"
 	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/AvdeevK/url-cutter.git/internal/threats"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	auth.InitializeKeyring(auth.DevKeyring())
+	os.Exit(m.Run())
+}
+
 func TestPostJSONURLHandler(t *testing.T) {
 	// описываем ожидаемое тело ответа при успешном запросе
 
@@ -41,7 +65,7 @@ func TestPostJSONURLHandler(t *testing.T) {
 			testName:     "Тест с длинным  URL",
 			method:       http.MethodPost,
 			expectedCode: http.StatusCreated,
-			requestBody:  `{"url": "https:/oAJIzeMUgAXdCOxIwlsqKqFrIiDtQDGoxyIwFvtsuiuBTHkjXQtpkoANYiFbnYIoJUJOWOlxvUIY.ru/"}`,
+			requestBody:  `{"url": "https://oAJIzeMUgAXdCOxIwlsqKqFrIiDtQDGoxyIwFvtsuiuBTHkjXQtpkoANYiFbnYIoJUJOWOlxvUIY.ru/"}`,
 		},
 	}
 
@@ -62,10 +86,52 @@ func TestPostJSONURLHandler(t *testing.T) {
 	}
 }
 
+func TestTTLSecondsLimit(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+	maxTTL := int64(math.MaxInt64 / int64(time.Second))
+
+	tests := []struct {
+		name         string
+		ttlSeconds   int64
+		expectedCode int
+	}{
+		{name: "max ttl", ttlSeconds: maxTTL, expectedCode: http.StatusCreated},
+		{name: "ttl overflows duration", ttlSeconds: maxTTL + 1, expectedCode: http.StatusBadRequest},
+		{name: "max int64", ttlSeconds: math.MaxInt64, expectedCode: http.StatusBadRequest},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := fmt.Sprintf("https://example.com/ttl/%d", i)
+
+			w := httptest.NewRecorder()
+			body := fmt.Sprintf(`{"url": %q, "ttl_seconds": %d}`, target+"/json", test.ttlSeconds)
+			handlers.PostJSONHandler(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+			assert.Equal(t, test.expectedCode, w.Code)
+
+			w = httptest.NewRecorder()
+			path := fmt.Sprintf("/?ttl_seconds=%d", test.ttlSeconds)
+			handlers.PostURLHandler(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(target+"/text")))
+			assert.Equal(t, test.expectedCode, w.Code)
+
+			w = httptest.NewRecorder()
+			body = fmt.Sprintf(`[{"correlation_id": "1", "original_url": %q, "ttl_seconds": %d}]`, target+"/batch", test.ttlSeconds)
+			handlers.PostBatchURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+			var responses []models.BatchResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&responses))
+			if test.expectedCode == http.StatusCreated {
+				assert.Equal(t, models.BatchStatusCreated, responses[0].Status)
+			} else {
+				assert.Equal(t, models.BatchStatusInvalid, responses[0].Status)
+			}
+		})
+	}
+}
+
 func TestPostURLHandler(t *testing.T) {
 	// описываем ожидаемое тело ответа при успешном запросе
 
 	requredPathOfResponseBody := config.Configs.ResponseAddress
+	handlers.InitializeStorage(storage.NewMemoryStorage())
 
 	testCases := []struct {
 		testName     string
@@ -89,9 +155,21 @@ func TestPostURLHandler(t *testing.T) {
 			testName:     "Тест с длинным  URL",
 			method:       http.MethodPost,
 			expectedCode: http.StatusCreated,
-			requestBody: "https:/oAJIzeMUgAXdCOxIwlsqKqFrIiDtQDGoxyIw" +
+			requestBody: "https://oAJIzeMUgAXdCOxIwlsqKqFrIiDtQDGoxyIw" +
 				"FvtsuiuBTHkjXQtpkoANYiFbnYIoJUJOWOlxvUIY.ru/",
 		},
+		{
+			testName:     "Тест с недопустимой схемой",
+			method:       http.MethodPost,
+			expectedCode: http.StatusBadRequest,
+			requestBody:  "javascript:alert(1)",
+		},
+		{
+			testName:     "Тест с тем же URL в другом регистре",
+			method:       http.MethodPost,
+			expectedCode: http.StatusConflict,
+			requestBody:  "HTTPS://Dzen.RU:443",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -114,20 +192,31 @@ func TestPostURLHandler(t *testing.T) {
 
 func TestGetURLHandler(t *testing.T) {
 
-	handlers.InitializeStorage(storage.NewMemoryStorage())
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
 
-	models.PairsOfURLs["qMBUnCeI"] = models.OriginalURLSelectionResult{
-		OriginalURL: "http://yandex.ru",
-		IsDeleted:   false,
-		Error:       nil,
-		UserID:      "lxM1u4yYR22ewAVJtXxtKw==",
+	expiredAt := time.Now().Add(-time.Minute)
+	records := map[string]models.AddNewURLRecord{
+		"qMBUnCeI": {
+			ShortURL:    "qMBUnCeI",
+			OriginalURL: "http://yandex.ru",
+			UserID:      "lxM1u4yYR22ewAVJtXxtKw==",
+		},
+		"hbflpNSd": {
+			ShortURL: "hbflpNSd",
+			OriginalURL: "http://wLlvfmtuXUcjYopEUIpsmFORoKlQyINZQwucmqLKzLzJM" +
+				"oAdIDWcMfAiJhDZZZlQbZWsolaiYEFUtQGZTBfvQGMZzbVaCWdOFLSZ.com",
+			UserID: "lxM1u4yYR22ewAVJtXxtKw==",
+		},
+		"xpRdLnKk": {
+			ShortURL:    "xpRdLnKk",
+			OriginalURL: "http://practicum.yandex.ru",
+			UserID:      "lxM1u4yYR22ewAVJtXxtKw==",
+			ExpiresAt:   &expiredAt,
+		},
 	}
-	models.PairsOfURLs["hbflpNSd"] = models.OriginalURLSelectionResult{
-		OriginalURL: "http://wLlvfmtuXUcjYopEUIpsmFORoKlQyINZQwucmqLKzLzJM" +
-			"oAdIDWcMfAiJhDZZZlQbZWsolaiYEFUtQGZTBfvQGMZzbVaCWdOFLSZ.com",
-		IsDeleted: false,
-		Error:     nil,
-		UserID:    "lxM1u4yYR22ewAVJtXxtKw==",
+	for _, record := range records {
+		assert.NoError(t, store.SaveURL(context.Background(), record))
 	}
 
 	testCases := []struct {
@@ -142,7 +231,7 @@ func TestGetURLHandler(t *testing.T) {
 			method:         http.MethodGet,
 			expectedCode:   http.StatusTemporaryRedirect,
 			path:           "/qMBUnCeI",
-			headerLocation: models.PairsOfURLs["qMBUnCeI"].OriginalURL,
+			headerLocation: records["qMBUnCeI"].OriginalURL,
 		},
 		{
 			testName:       "Тест с пустым телом запроса",
@@ -156,7 +245,7 @@ func TestGetURLHandler(t *testing.T) {
 			method:         http.MethodGet,
 			expectedCode:   http.StatusTemporaryRedirect,
 			path:           "/hbflpNSd",
-			headerLocation: models.PairsOfURLs["hbflpNSd"].OriginalURL,
+			headerLocation: records["hbflpNSd"].OriginalURL,
 		},
 		{
 			testName:       "Тест с несуществующим коротким  URL",
@@ -165,6 +254,13 @@ func TestGetURLHandler(t *testing.T) {
 			path:           "/GNBlDGPP",
 			headerLocation: "",
 		},
+		{
+			testName:       "Тест с истёкшим коротким URL",
+			method:         http.MethodGet,
+			expectedCode:   http.StatusGone,
+			path:           "/xpRdLnKk",
+			headerLocation: "",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -185,3 +281,829 @@ func TestGetURLHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestGetURLHandlerRedirectType(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+
+	config.Configs.RedirectCode = http.StatusFound
+	config.Configs.PermanentRedirectTTL = time.Hour
+	defer func() {
+		config.Configs.RedirectCode = 0
+		config.Configs.PermanentRedirectTTL = 0
+	}()
+
+	expiresAt := time.Now().Add(10 * time.Minute)
+	records := []models.AddNewURLRecord{
+		{ShortURL: "default", OriginalURL: "https://example.com/default", UserID: "alice"},
+		{ShortURL: "moved", OriginalURL: "https://example.com/moved", UserID: "alice", RedirectType: http.StatusMovedPermanently},
+		{ShortURL: "expiring", OriginalURL: "https://example.com/expiring", UserID: "alice", RedirectType: http.StatusPermanentRedirect, ExpiresAt: &expiresAt},
+	}
+	for _, record := range records {
+		assert.NoError(t, store.SaveURL(context.Background(), record))
+	}
+
+	visitor := httptest.NewRecorder()
+	assert.NoError(t, auth.SetAuthCookie(visitor, "bob"))
+	cookie := visitor.Result().Cookies()[0]
+
+	testCases := []struct {
+		path         string
+		cookie       *http.Cookie
+		expectedCode int
+		cacheControl string
+	}{
+		{path: "/default", cookie: cookie, expectedCode: http.StatusFound, cacheControl: "private, no-store"},
+		{path: "/moved", cookie: cookie, expectedCode: http.StatusMovedPermanently, cacheControl: "public, max-age=3600"},
+		{path: "/expiring", cookie: cookie, expectedCode: http.StatusPermanentRedirect, cacheControl: "public, max-age=599"},
+		// Первый визит: ответ выдаёт куку и не должен попасть в общий кэш.
+		{path: "/moved", expectedCode: http.StatusMovedPermanently, cacheControl: "private, max-age=3600"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+			w := httptest.NewRecorder()
+			handlers.GetURLHandler(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.cacheControl, w.Header().Get("Cache-Control"))
+			if strings.HasPrefix(w.Header().Get("Cache-Control"), "public") {
+				assert.Empty(t, w.Header().Values("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func TestPostURLHandlerRejectsRedirectType(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	r := httptest.NewRequest(http.MethodPost, "/?redirect_type=303", strings.NewReader("https://example.com/see-other"))
+	w := httptest.NewRecorder()
+	handlers.PostURLHandler(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPostURLHandlerSkipsTakenSequentialCode(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+	codes, err := shortcode.NewSequentialGenerator(store, shortcode.Base62, 4, "")
+	assert.NoError(t, err)
+	handlers.InitializeCodeGenerator(codes)
+	defer handlers.InitializeCodeGenerator(shortcode.NewRandomGenerator(shortcode.Base62, 8))
+
+	// Псевдоним занимает код, который счётчик выдал бы первым.
+	assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+		ShortURL:    "0001",
+		OriginalURL: "https://example.com/alias",
+		UserID:      "alice",
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/generated"))
+	w := httptest.NewRecorder()
+	handlers.PostURLHandler(w, r)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, config.Configs.ResponseAddress+"/0002", w.Body.String())
+}
+
+func TestPostBatchURLHandlerRetriesTakenSequentialCode(t *testing.T) {
+	fileStore, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "urls.json"), storage.SyncNever)
+	assert.NoError(t, err)
+	defer fileStore.Close()
+	defer handlers.InitializeCodeGenerator(shortcode.NewRandomGenerator(shortcode.Base62, 8))
+
+	for name, store := range map[string]storage.Storage{"memory": storage.NewMemoryStorage(), "file": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			handlers.InitializeStorage(store)
+			codes, err := shortcode.NewSequentialGenerator(store, shortcode.Base62, 4, "")
+			assert.NoError(t, err)
+			handlers.InitializeCodeGenerator(codes)
+
+			// Псевдоним занимает второй код первой попытки.
+			assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+				ShortURL:    "0002",
+				OriginalURL: "https://example.com/alias",
+				UserID:      "alice",
+			}))
+
+			body := `[{"correlation_id":"1","original_url":"https://example.com/a"},
+				{"correlation_id":"2","original_url":"https://example.com/b"},
+				{"correlation_id":"3","original_url":"https://example.com/c"}]`
+			w := httptest.NewRecorder()
+			handlers.PostBatchURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var responses []models.BatchResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&responses))
+			for i, response := range responses {
+				assert.Equal(t, models.BatchStatusCreated, response.Status)
+				assert.Equal(t, fmt.Sprintf("%s/%04d", config.Configs.ResponseAddress, i+4), response.ShortURL)
+			}
+			// От первой попытки не осталось записи.
+			assert.ErrorIs(t, store.GetOriginalURL(context.Background(), "0001").Error, storage.ErrNotFound)
+		})
+	}
+}
+
+func TestReservedPrefixes(t *testing.T) {
+	r := chi.NewRouter()
+	registerRoutes(r)
+
+	prefixes, err := reservedPrefixes(r)
+	assert.NoError(t, err)
+	assert.Contains(t, prefixes, "ping")
+	assert.Contains(t, prefixes, "api")
+	assert.NotContains(t, prefixes, "{link}")
+}
+
+func TestPostJSONHandlerRejectsBlockedAlias(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+	blocked := blocklist.New()
+	blocked.Reserve("ping")
+	blocked.AddWords("badword")
+	handlers.InitializeBlocklist(blocked)
+	defer handlers.InitializeBlocklist(blocklist.New())
+
+	for _, alias := range []string{"ping", "my-BadWord"} {
+		body := `{"url":"https://example.com/` + alias + `","alias":"` + alias + `"}`
+		w := httptest.NewRecorder()
+		handlers.PostJSONHandler(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, alias)
+	}
+}
+
+func TestDomainPolicyAndBlocking(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+
+	rules := filepath.Join(t.TempDir(), "policy.txt")
+	assert.NoError(t, os.WriteFile(rules, []byte("deny *.phish.example\n"), 0o644))
+	destinations, err := policy.Load(rules)
+	assert.NoError(t, err)
+	audit, err := policy.NewAudit(10, "")
+	assert.NoError(t, err)
+	handlers.InitializePolicy(destinations, audit)
+	defer func() {
+		defaultAudit, _ := policy.NewAudit(100, "")
+		handlers.InitializePolicy(policy.New(), defaultAudit)
+	}()
+
+	config.Configs.AdminToken = "secret"
+	defer func() { config.Configs.AdminToken = "" }()
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	admin := http.Header{"X-Admin-Token": {"secret"}}
+
+	w := serve(http.MethodPost, "/", "https://login.phish.example/bank", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+		ShortURL:    "promo",
+		OriginalURL: "https://example.com/promo",
+		UserID:      "alice",
+	}))
+
+	w = serve(http.MethodPost, "/api/admin/urls/promo/block", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serve(http.MethodPost, "/api/admin/urls/missing/block", "", admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(http.MethodPost, "/api/admin/urls/promo/block", `{"reason":"malware"}`, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(http.MethodGet, "/promo", "", http.Header{"Accept": {"text/html"}})
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Contains(t, w.Body.String(), "malware")
+	assert.Empty(t, w.Header().Get("Location"))
+
+	w = serve(http.MethodDelete, "/api/admin/urls/promo/block", "", admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(http.MethodGet, "/promo", "", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	w = serve(http.MethodGet, "/api/admin/audit", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.AuditEvent
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+	actions := make([]string, 0, len(events))
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{
+		models.AuditActionURLUnblocked,
+		models.AuditActionRedirectDenied,
+		models.AuditActionURLBlocked,
+		models.AuditActionShortenDenied,
+	}, actions)
+}
+
+func TestThreatListWarning(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+
+	hash := sha256.Sum256([]byte("malware.example/"))
+	list := fmt.Sprintf(`{"listUpdateResponses":[{"threatType":"MALWARE","additions":[{"rawHashes":{"prefixSize":32,"rawHashes":%q}}]}]}`,
+		base64.StdEncoding.EncodeToString(hash[:]))
+	path := filepath.Join(t.TempDir(), "threats.json")
+	assert.NoError(t, os.WriteFile(path, []byte(list), 0o644))
+	scanner, err := threats.Load(path)
+	assert.NoError(t, err)
+	handlers.InitializeThreatScanner(scanner)
+	defer handlers.InitializeThreatScanner(threats.New())
+
+	w := httptest.NewRecorder()
+	handlers.PostURLHandler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://cdn.malware.example/setup.exe")))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	shortURL := strings.TrimPrefix(w.Body.String(), config.Configs.ResponseAddress+"/")
+	assert.Equal(t, "MALWARE", store.GetOriginalURL(context.Background(), shortURL).ThreatType)
+
+	r := httptest.NewRequest(http.MethodGet, "/"+shortURL, nil)
+	r.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	handlers.GetURLHandler(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "MALWARE")
+	assert.Contains(t, w.Body.String(), "https://cdn.malware.example/setup.exe")
+}
+
+func TestThreatListPrefixMatchIsNotFlagged(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+	audit, err := policy.NewAudit(10, "")
+	assert.NoError(t, err)
+	handlers.InitializePolicy(policy.New(), audit)
+	defer func() {
+		defaultAudit, _ := policy.NewAudit(100, "")
+		handlers.InitializePolicy(policy.New(), defaultAudit)
+	}()
+
+	hash := sha256.Sum256([]byte("clean.example/"))
+	list := fmt.Sprintf(`{"listUpdateResponses":[{"threatType":"MALWARE","additions":[{"rawHashes":{"prefixSize":4,"rawHashes":%q}}]}]}`,
+		base64.StdEncoding.EncodeToString(hash[:4]))
+	path := filepath.Join(t.TempDir(), "threats.json")
+	assert.NoError(t, os.WriteFile(path, []byte(list), 0o644))
+	scanner, err := threats.Load(path)
+	assert.NoError(t, err)
+	handlers.InitializeThreatScanner(scanner)
+	defer handlers.InitializeThreatScanner(threats.New())
+
+	w := httptest.NewRecorder()
+	handlers.PostURLHandler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://clean.example/page")))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	shortURL := strings.TrimPrefix(w.Body.String(), config.Configs.ResponseAddress+"/")
+	assert.Empty(t, store.GetOriginalURL(context.Background(), shortURL).ThreatType)
+
+	w = httptest.NewRecorder()
+	handlers.GetURLHandler(w, httptest.NewRequest(http.MethodGet, "/"+shortURL, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://clean.example/page", w.Header().Get("Location"))
+
+	events := audit.Recent()
+	assert.NotEmpty(t, events)
+	for _, event := range events {
+		assert.Equal(t, models.AuditActionThreatUnverified, event.Action)
+	}
+}
+
+type clickCapturingStorage struct {
+	*storage.MemoryStorage
+	events []models.ClickEvent
+}
+
+func (c *clickCapturingStorage) SaveClicks(ctx context.Context, events []models.ClickEvent) error {
+	c.events = append(c.events, events...)
+	return c.MemoryStorage.SaveClicks(ctx, events)
+}
+
+// recordClicks выполняет запросы к ссылкам и дожидается сохранения переходов.
+func recordClicks(s storage.Storage, requests ...*http.Request) {
+	recorder := analytics.NewRecorder(s, 10, time.Hour)
+	handlers.InitializeClickRecorder(recorder)
+	defer handlers.InitializeClickRecorder(nil)
+
+	for _, req := range requests {
+		handlers.GetURLHandler(httptest.NewRecorder(), req)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder.Run(ctx)
+}
+
+func TestURLStats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+	assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+		ShortURL: "stats", OriginalURL: "https://example.com/stats", UserID: "alice",
+	}))
+
+	recordClicks(store,
+		httptest.NewRequest(http.MethodGet, "/stats", nil),
+		httptest.NewRequest(http.MethodGet, "/stats", nil),
+	)
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(path, userID string) *httptest.ResponseRecorder {
+		issued := httptest.NewRecorder()
+		assert.NoError(t, auth.SetAuthCookie(issued, userID))
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(issued.Result().Cookies()[0])
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/api/user/urls/stats/stats", "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats models.URLStats
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Equal(t, int64(2), stats.TotalClicks)
+	assert.NotNil(t, stats.LastClickAt)
+
+	w = serve("/api/user/urls/stats/stats", "bob")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serve("/api/user/urls/missing/stats", "alice")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestClickClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	store := &clickCapturingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	handlers.InitializeStorage(store)
+	assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+		ShortURL: "ip", OriginalURL: "https://example.com/ip", UserID: "alice",
+	}))
+
+	proxies, err := handlers.ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	assert.NoError(t, err)
+	_, err = handlers.ParseTrustedProxies("not-an-ip")
+	assert.Error(t, err)
+
+	request := func(remoteAddr string, header map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		return req
+	}
+
+	// Без доверенных прокси заголовки игнорируются.
+	recordClicks(store, request("198.51.100.9:1234", map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"}))
+
+	handlers.InitializeTrustedProxies(proxies)
+	defer handlers.InitializeTrustedProxies(nil)
+	recordClicks(store,
+		// Запрос не от прокси.
+		request("198.51.100.9:1234", map[string]string{"X-Forwarded-For": "203.0.113.7"}),
+		// Клиент дописал поддельный адрес перед своим, прокси добавили настоящий.
+		request("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7, 10.0.0.2"}),
+		request("192.0.2.1:1234", map[string]string{"X-Real-IP": "203.0.113.8"}),
+	)
+
+	ips := make([]string, 0, len(store.events))
+	for _, event := range store.events {
+		ips = append(ips, event.ClientIP)
+	}
+	assert.Equal(t, []string{"198.51.100.9", "198.51.100.9", "203.0.113.7", "203.0.113.8"}, ips)
+}
+
+// pingStorage отвечает на Ping ошибкой или ждёт отмены контекста операции.
+type pingStorage struct {
+	*storage.MemoryStorage
+	err   error
+	block bool
+}
+
+func (p *pingStorage) Ping(ctx context.Context) error {
+	if p.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return p.err
+}
+
+func TestPingDBHandler(t *testing.T) {
+	defer func(timeout time.Duration) { config.Configs.StorageTimeout = timeout }(config.Configs.StorageTimeout)
+	config.Configs.StorageTimeout = 20 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		store    storage.Storage
+		expected int
+	}{
+		{name: "memory storage", store: storage.NewMemoryStorage(), expected: http.StatusOK},
+		{name: "ping fails", store: &pingStorage{MemoryStorage: storage.NewMemoryStorage(), err: errors.New("connection refused")}, expected: http.StatusInternalServerError},
+		{name: "ping times out", store: &pingStorage{MemoryStorage: storage.NewMemoryStorage(), block: true}, expected: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handlers.InitializeStorage(test.store)
+			w := httptest.NewRecorder()
+			handlers.PingDBHandler(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+			assert.Equal(t, test.expected, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handlers.PingDBHandler(w, httptest.NewRequest(http.MethodPost, "/ping", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/api/user/keys", `{"name":"ci"}`, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	cookies := w.Result().Cookies()
+	assert.NotEmpty(t, cookies)
+	owner := http.Header{"Cookie": {cookies[0].String()}}
+	var created models.CreateAPIKeyResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+
+	// Ссылка, созданная по ключу, видна владельцу ключа через куку.
+	w = serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/by-key"}`, http.Header{"X-Api-Key": {created.Key}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = serve(http.MethodGet, "/api/user/urls", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/by-key")
+
+	w = serve(http.MethodGet, "/api/user/keys", "", http.Header{"Authorization": {"Bearer " + created.Key}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var keys []models.APIKey
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&keys))
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "ci", keys[0].Name)
+
+	w = serve(http.MethodDelete, "/api/user/keys/"+created.ID, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(http.MethodDelete, "/api/user/keys/"+created.ID, "", owner)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(http.MethodGet, "/api/user/urls", "", http.Header{"X-Api-Key": {created.Key}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serve(http.MethodGet, "/api/user/urls", "", http.Header{"X-Api-Key": {"uc_unknown"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSessionRenewalAndLogout(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+	defer auth.InitializeCookie(auth.CookieOptions{Lifetime: 3 * time.Hour, SameSite: http.SameSiteLaxMode})
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	authCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == "bearer" {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	auth.InitializeCookie(auth.CookieOptions{Lifetime: time.Hour, SameSite: http.SameSiteStrictMode, Secure: true})
+	w := serve(http.MethodPost, "/", "https://example.com/session", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	first := authCookie(w)
+	assert.NotNil(t, first)
+	assert.True(t, first.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, first.SameSite)
+
+	// Свежий токен не перевыпускается.
+	w = serve(http.MethodGet, "/api/user/urls", "", first)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, authCookie(w))
+
+	// С длинным сроком жизни у токена осталось меньше половины срока, и он продлевается
+	// для того же пользователя.
+	auth.InitializeCookie(auth.CookieOptions{Lifetime: 3 * time.Hour, SameSite: http.SameSiteLaxMode})
+	w = serve(http.MethodGet, "/api/user/urls", "", first)
+	assert.Equal(t, http.StatusOK, w.Code)
+	renewed := authCookie(w)
+	assert.NotNil(t, renewed)
+	assert.NotEqual(t, first.Value, renewed.Value)
+	w = serve(http.MethodGet, "/api/user/urls", "", renewed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/session")
+
+	w = serve(http.MethodPost, "/api/user/logout", "", renewed)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	cleared := authCookie(w)
+	assert.NotNil(t, cleared)
+	assert.Empty(t, cleared.Value)
+	assert.Negative(t, cleared.MaxAge)
+
+	// Выход отзывает всю сессию, включая токен, выданный до продления.
+	for _, cookie := range []*http.Cookie{first, renewed} {
+		w = serve(http.MethodGet, "/api/user/urls", "", cookie)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w = serve(http.MethodPost, "/api/user/logout", "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAccountsClaimAnonymousURLs(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(method, path, body string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		for _, issued := range w.Result().Cookies() {
+			if issued.Name == "bearer" {
+				return w, issued
+			}
+		}
+		return w, cookie
+	}
+
+	w, anonymous := serve(http.MethodPost, "/", "https://example.com/before-signup", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w, account := serve(http.MethodPost, "/api/user/register", `{"login":"Alice","password":"correct horse"}`, anonymous)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var registered models.AccountResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	assert.Equal(t, "alice", registered.Login)
+	assert.EqualValues(t, 1, registered.Claimed)
+	assert.NotContains(t, w.Body.String(), "correct horse")
+
+	w, _ = serve(http.MethodGet, "/api/user/urls", "", account)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/before-signup")
+
+	w, _ = serve(http.MethodPost, "/api/user/register", `{"login":" ALICE ","password":"another password"}`, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w, _ = serve(http.MethodPost, "/api/user/register", `{"login":"bob","password":"short"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Вход из другого браузера: ссылки его анонимного пользователя переносятся
+	// только по явной просьбе.
+	w, otherBrowser := serve(http.MethodPost, "/", "https://example.com/other-browser", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w, _ = serve(http.MethodPost, "/api/user/login", `{"login":"alice","password":"wrong password"}`, otherBrowser)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = serve(http.MethodPost, "/api/user/login", `{"login":"mallory","password":"wrong password"}`, otherBrowser)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w, _ = serve(http.MethodPost, "/api/user/login", `{"login":"alice","password":"correct horse"}`, otherBrowser)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"claimed":0`)
+	w, loggedIn := serve(http.MethodPost, "/api/user/login", `{"login":"alice","password":"correct horse","claim":true}`, otherBrowser)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"claimed":1`)
+
+	w, _ = serve(http.MethodGet, "/api/user/urls", "", loggedIn)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/before-signup")
+	assert.Contains(t, w.Body.String(), "https://example.com/other-browser")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+	issuer, err := oidctest.NewIssuer("url-cutter", "client-secret")
+	assert.NoError(t, err)
+	defer issuer.Close()
+
+	r := chi.NewRouter()
+	registerRoutes(r)
+	serve := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, issued := range w.Result().Cookies() {
+			if issued.Name == name && issued.Value != "" {
+				return issued
+			}
+		}
+		return nil
+	}
+
+	w := serve("/api/user/oidc/login")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+		IssuerURL:    issuer.URL(),
+		ClientID:     "url-cutter",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/api/user/oidc/callback",
+	})
+	assert.NoError(t, err)
+	handlers.InitializeOIDC(provider)
+	defer handlers.InitializeOIDC(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/before-sso"))
+	created := httptest.NewRecorder()
+	r.ServeHTTP(created, req)
+	assert.Equal(t, http.StatusCreated, created.Code)
+	anonymous := cookie(created, "bearer")
+
+	w = serve("/api/user/oidc/login?claim=true", anonymous)
+	assert.Equal(t, http.StatusFound, w.Code)
+	flowCookie := cookie(w, "oidc_flow")
+	assert.NotNil(t, flowCookie)
+
+	callback, err := issuer.Authorize(w.Header().Get("Location"), "employee-42", "alice@example.com")
+	assert.NoError(t, err)
+	callbackURL, err := url.Parse(callback)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/user/oidc/callback", callbackURL.Path)
+
+	// Ответ провайдера без куки входа или с чужим state отклоняется.
+	w = serve(callbackURL.RequestURI(), anonymous)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	forged := callbackURL.Query()
+	forged.Set("state", "forged")
+	w = serve(callbackURL.Path+"?"+forged.Encode(), anonymous, flowCookie)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(callbackURL.RequestURI(), anonymous, flowCookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var login models.OIDCLoginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&login))
+	assert.Equal(t, auth.OIDCUserID(issuer.URL(), "employee-42"), login.UserID)
+	assert.Equal(t, "employee-42", login.Subject)
+	assert.EqualValues(t, 1, login.Claimed)
+	account := cookie(w, "bearer")
+	assert.NotNil(t, account)
+
+	w = serve("/api/user/urls", account)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/before-sso")
+
+	// Повторный вход тем же сотрудником даёт того же пользователя.
+	w = serve("/api/user/oidc/login")
+	flowCookie = cookie(w, "oidc_flow")
+	callback, err = issuer.Authorize(w.Header().Get("Location"), "employee-42", "alice@example.com")
+	assert.NoError(t, err)
+	callbackURL, err = url.Parse(callback)
+	assert.NoError(t, err)
+	w = serve(callbackURL.RequestURI(), flowCookie)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), login.UserID)
+	assert.Contains(t, w.Body.String(), `"claimed":0`)
+}
+
+func TestPostJSONHandlerWithAlias(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	testCases := []struct {
+		testName     string
+		expectedCode int
+		requestBody  string
+		expectedBody string
+	}{
+		{
+			testName:     "Тест с новым алиасом",
+			expectedCode: http.StatusCreated,
+			requestBody:  `{"url": "https://practicum.yandex.ru/", "alias": "q4-report"}`,
+			expectedBody: "/q4-report",
+		},
+		{
+			testName:     "Тест с занятым алиасом",
+			expectedCode: http.StatusConflict,
+			requestBody:  `{"url": "https://ya.ru/", "alias": "q4-report"}`,
+			expectedBody: `"error"`,
+		},
+		{
+			testName:     "Тест с недопустимыми символами в алиасе",
+			expectedCode: http.StatusBadRequest,
+			requestBody:  `{"url": "https://ya.ru/", "alias": "q4 report!"}`,
+			expectedBody: `"error"`,
+		},
+		{
+			testName:     "Тест со слишком коротким алиасом",
+			expectedCode: http.StatusBadRequest,
+			requestBody:  `{"url": "https://ya.ru/", "alias": "q4"}`,
+			expectedBody: `"error"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tc.requestBody))
+			w := httptest.NewRecorder()
+
+			handlers.PostJSONHandler(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestPostURLHandlerConflict(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	r := httptest.NewRequest(http.MethodPost, "/?alias=dzen-news", strings.NewReader("https://dzen.ru/news"))
+	w := httptest.NewRecorder()
+	handlers.PostURLHandler(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, "Код ответа не совпадает с ожидаемым")
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://dzen.ru/news"))
+	w = httptest.NewRecorder()
+	handlers.PostURLHandler(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code, "Код ответа не совпадает с ожидаемым")
+	assert.Contains(t, w.Body.String(), "/dzen-news")
+}
+
+func TestPostBatchURLHandlerReturnsExistingURL(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handlers.InitializeStorage(store)
+	assert.NoError(t, store.SaveURL(context.Background(), models.AddNewURLRecord{
+		ShortURL: "sport", OriginalURL: "https://dzen.ru/sport", UserID: "alice",
+	}))
+
+	body := `[{"correlation_id": "1", "original_url": "https://dzen.ru/sport"}]`
+	w := httptest.NewRecorder()
+	handlers.PostBatchURLHandler(w, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)))
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var responses []models.BatchResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&responses))
+	assert.Equal(t, []models.BatchResponse{{
+		CorrelationID: "1",
+		ShortURL:      config.Configs.ResponseAddress + "/sport",
+		Status:        models.BatchStatusExisting,
+	}}, responses)
+}
+
+func TestPostBatchURLHandlerPartialSuccess(t *testing.T) {
+	handlers.InitializeStorage(storage.NewMemoryStorage())
+
+	body := `[
+		{"correlation_id": "1", "original_url": "https://dzen.ru/sport"},
+		{"correlation_id": "2", "original_url": ""},
+		{"correlation_id": "3", "original_url": "https://dzen.ru/sport"}
+	]`
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handlers.PostBatchURLHandler(w, r)
+	assert.Equal(t, http.StatusMultiStatus, w.Code, "Код ответа не совпадает с ожидаемым")
+
+	var responses []models.BatchResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&responses))
+	if assert.Len(t, responses, 3) {
+		assert.Equal(t, models.BatchStatusCreated, responses[0].Status)
+		assert.Equal(t, models.BatchStatusInvalid, responses[1].Status)
+		assert.NotEmpty(t, responses[1].Error)
+		assert.Equal(t, models.BatchStatusExisting, responses[2].Status)
+		assert.Equal(t, responses[0].ShortURL, responses[2].ShortURL)
+	}
+
+	config.Configs.BatchMaxSize = 2
+	defer func() { config.Configs.BatchMaxSize = 0 }()
+	r = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	handlers.PostBatchURLHandler(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "Код ответа не совпадает с ожидаемым")
+}
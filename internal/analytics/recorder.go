@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"context"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"time"
+)
+
+const maxBatchSize = 500
+
+// Recorder копит события переходов в буфере и сохраняет их пачками,
+// чтобы запись статистики не замедляла редирект.
+type Recorder struct {
+	store         storage.Storage
+	events        chan models.ClickEvent
+	flushInterval time.Duration
+}
+
+func NewRecorder(store storage.Storage, bufferSize int, flushInterval time.Duration) *Recorder {
+	return &Recorder{
+		store:         store,
+		events:        make(chan models.ClickEvent, bufferSize),
+		flushInterval: flushInterval,
+	}
+}
+
+// Record не блокируется: при переполненном буфере событие отбрасывается.
+func (r *Recorder) Record(event models.ClickEvent) bool {
+	select {
+	case r.events <- event:
+		return true
+	default:
+		logger.Log.Warn("click buffer is full, event dropped", zap.String("short_url", event.ShortURL))
+		return false
+	}
+}
+
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, maxBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-r.events:
+					batch = append(batch, event)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) >= maxBatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []models.ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	// Сброс выполняется и при остановке, поэтому контекст не наследуется от Run.
+	ctx, cancel := storage.OperationContext(context.Background())
+	defer cancel()
+
+	if err := r.store.SaveClicks(ctx, batch); err != nil {
+		logger.Log.Error("failed to save click events", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
@@ -0,0 +1,41 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorderFlushesOnStop(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	r := NewRecorder(s, 10, time.Hour)
+
+	clickedAt := time.Date(2025, 1, 12, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		assert.True(t, r.Record(models.ClickEvent{ShortURL: "abc", ClickedAt: clickedAt}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	stats, err := s.GetURLStats(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+}
+
+func TestRecorderDropsEventsWhenBufferIsFull(t *testing.T) {
+	r := NewRecorder(storage.NewMemoryStorage(), 1, time.Hour)
+
+	assert.True(t, r.Record(models.ClickEvent{ShortURL: "abc"}))
+	assert.False(t, r.Record(models.ClickEvent{ShortURL: "abc"}))
+}
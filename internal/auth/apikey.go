@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// APIKeyPrefix отличает ключи API от других токенов в заголовке Authorization.
+const APIKeyPrefix = "uc_"
+
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyDisplayLength — сколько первых символов ключа показывается в списке ключей.
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+// GenerateAPIKey возвращает новый ключ и его начало для показа пользователю.
+func GenerateAPIKey() (key, displayPrefix string, err error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(bytes)
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// HashAPIKey — ключи случайные и длинные, поэтому для хранения достаточно SHA-256.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyFromRequest читает ключ из X-API-Key или из Authorization: Bearer.
+func APIKeyFromRequest(r *http.Request) (string, bool) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key, true
+	}
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") && strings.HasPrefix(token, APIKeyPrefix) {
+		return token, true
+	}
+	return "", false
+}
+
+type userIDKey struct{}
+
+// WithUserID запоминает в контексте пользователя, уже определённого по ключу API.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(string)
+	return userID, ok && userID != ""
+}
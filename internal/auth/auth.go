@@ -5,30 +5,65 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"github.com/AvdeevK/url-cutter.git/internal/logger"
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 )
 
 const cookieName = "bearer"
-const tokenExp = time.Hour * 3
 
-var secretKey string
+var ErrNoAuthCookie = errors.New("token cookie not found")
 
-func init() {
-	secretKey = os.Getenv("SECRET_KEY")
-	if secretKey == "" {
-		logger.Log.Warn("system variable is non set or empty, use default key")
-		secretKey = "supersecretkey"
+var keyring *Keyring
+
+// InitializeKeyring задаёт ключи подписи куки; без них куки не выдаются и не принимаются.
+func InitializeKeyring(k *Keyring) {
+	keyring = k
+}
+
+// CookieOptions — атрибуты куки с токеном. Lifetime — срок жизни одного токена;
+// при активности пользователя токен продлевается, см. NeedsRenewal.
+type CookieOptions struct {
+	Lifetime time.Duration
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+var cookieOptions = CookieOptions{
+	Lifetime: 3 * time.Hour,
+	SameSite: http.SameSiteLaxMode,
+}
+
+func InitializeCookie(opts CookieOptions) {
+	cookieOptions = opts
+}
+
+func SessionLifetime() time.Duration {
+	return cookieOptions.Lifetime
+}
+
+// ParseSameSite разбирает значение атрибута SameSite: lax, strict или none.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unsupported SameSite %q: use lax, strict or none", value)
 	}
 }
 
 // Взято из примера урока, структура будет из одного поля.
+// SessionID не меняется при продлении токена, по нему сессия отзывается целиком.
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID string
+	UserID    string
+	SessionID string `json:"sid,omitempty"`
 }
 
 func GenerateUserID() (string, error) {
@@ -39,64 +74,117 @@ func GenerateUserID() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
+// SetAuthCookie начинает для пользователя новую сессию.
 func SetAuthCookie(w http.ResponseWriter, userID string) error {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+	sessionID, err := GenerateUserID()
+	if err != nil {
+		return err
+	}
+	return setAuthCookie(w, userID, sessionID)
+}
+
+// RenewAuthCookie выдаёт новый токен в рамках той же сессии. У токенов, выпущенных
+// до появления сессий, сессия начинается заново.
+func RenewAuthCookie(w http.ResponseWriter, claims *Claims) error {
+	if claims.SessionID == "" {
+		return SetAuthCookie(w, claims.UserID)
+	}
+	return setAuthCookie(w, claims.UserID, claims.SessionID)
+}
+
+func setAuthCookie(w http.ResponseWriter, userID, sessionID string) error {
+	if keyring == nil {
+		return errors.New("token signing key is not configured")
+	}
+	now := time.Now()
+	expiresAt := now.Add(cookieOptions.Lifetime)
+	// создаём новый токен с утверждениями — Claims, алгоритм задаёт активный ключ
+	tokenString, err := keyring.Sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-		// собственное утверждение
-		UserID: userID,
+		// собственные утверждения
+		UserID:    userID,
+		SessionID: sessionID,
 	})
-
-	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
 		return errors.New("token signing error")
 	}
 
-	cookie := &http.Cookie{
+	http.SetCookie(w, newCookie(tokenString, expiresAt))
+	return nil
+}
+
+// ClearAuthCookie удаляет куку в браузере.
+func ClearAuthCookie(w http.ResponseWriter) {
+	cookie := newCookie("", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func newCookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
 		Name:     cookieName,
-		Value:    tokenString,
+		Value:    value,
 		HttpOnly: true,
 		Path:     "/",
-		Expires:  time.Now().Add(tokenExp),
+		Domain:   cookieOptions.Domain,
+		Secure:   cookieOptions.Secure,
+		SameSite: cookieOptions.SameSite,
+		Expires:  expires,
 	}
-	http.SetCookie(w, cookie)
+}
 
-	return nil
+// NeedsRenewal сообщает, что у токена осталось меньше половины срока жизни
+// и его пора заменить новым.
+func NeedsRenewal(claims *Claims, now time.Time) bool {
+	if claims.ExpiresAt == nil {
+		return true
+	}
+	return claims.ExpiresAt.Sub(now) < cookieOptions.Lifetime/2
 }
 
 func GetAuthCookie(r *http.Request) (string, bool, error) {
+	claims, err := ParseAuthCookie(r)
+	if errors.Is(err, ErrNoAuthCookie) {
+		//Комбинация, когда куки нет.
+		return "", false, err
+	}
+	if err != nil {
+		return "", true, err
+	}
+	//Комбинация токена, который существует, парсинг без ошибок.
+	return claims.UserID, true, nil
+}
+
+// ParseAuthCookie проверяет подпись и срок действия токена из куки.
+func ParseAuthCookie(r *http.Request) (*Claims, error) {
 	cookie, err := r.Cookie(cookieName)
 	if err != nil || cookie.Value == "" {
-		//Комбинация, когда куки нет.
-		return "", false, errors.New("token cookie not found")
+		return nil, ErrNoAuthCookie
+	}
+	if keyring == nil {
+		return nil, errors.New("token signing key is not configured")
 	}
 	// создаём экземпляр структуры с утверждениями
 	claims := &Claims{}
-	// парсим из строки токена tokenString в структуру claims
-	token, err := jwt.ParseWithClaims(cookie.Value, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
-
+	// парсим из строки токена tokenString в структуру claims, ключ выбирается по kid
+	token, err := keyring.Parse(cookie.Value, claims)
 	if err != nil {
-		return "", true, errors.New("unexpected signing method")
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
 	if !token.Valid {
-		return "", true, errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
 	if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
-		return "", true, errors.New("token has expired")
+		return nil, errors.New("token has expired")
 	}
-
-	//Комбинация токена, который существует, парсинг без ошибок.
-	return claims.UserID, true, nil
+	// Тем же ключом подписываются и другие токены, например кука входа через OIDC.
+	if claims.UserID == "" {
+		return nil, errors.New("token has no user id")
+	}
+	return claims, nil
 }
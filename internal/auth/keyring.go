@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Алгоритмы подписи токенов.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+const (
+	minSecretLength = 32
+	minRSABits      = 2048
+	// devSecret — прежний ключ по умолчанию, теперь доступный только в режиме разработки.
+	devSecret = "supersecretkey"
+	devKeyID  = "dev"
+	envKeyID  = "default"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no token signing key configured: set -auth-keys, AUTH_KEYS or SECRET_KEY, or -auth-dev-keys for development")
+	ErrUnknownKeyID = errors.New("token signed with unknown key")
+	ErrKeyRetired   = errors.New("token signed with retired key")
+)
+
+// KeyConfig описывает один ключ в файле ключей. Для HS256 задаётся secret,
+// для EdDSA и RS256 — PEM закрытого ключа; ключ только с public_key принимается
+// для проверки, но не может быть активным.
+type KeyConfig struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	Secret     string     `json:"secret,omitempty"`
+	PrivateKey string     `json:"private_key,omitempty"`
+	PublicKey  string     `json:"public_key,omitempty"`
+	RetireAt   *time.Time `json:"retire_at,omitempty"`
+}
+
+// KeyringConfig — содержимое файла ключей. Для ротации новый ключ добавляется
+// и делается активным, а старый остаётся в списке, пока не истекут выданные им
+// токены: после этого его удаляют или задают retire_at.
+type KeyringConfig struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+type tokenKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	retireAt  *time.Time
+}
+
+func (k *tokenKey) retired(now time.Time) bool {
+	return k.retireAt != nil && !now.Before(*k.retireAt)
+}
+
+type keySet struct {
+	active *tokenKey
+	keys   map[string]*tokenKey
+}
+
+func parseKeySet(data []byte) (*keySet, error) {
+	var cfg KeyringConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+
+	set := &keySet{keys: make(map[string]*tokenKey, len(cfg.Keys))}
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.ID == "" {
+			return nil, errors.New("key without kid")
+		}
+		if _, exists := set.keys[keyCfg.ID]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", keyCfg.ID)
+		}
+		key, err := parseKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyCfg.ID, err)
+		}
+		set.keys[key.id] = key
+	}
+
+	active, exists := set.keys[cfg.Active]
+	switch {
+	case !exists:
+		return nil, fmt.Errorf("active key %q not found", cfg.Active)
+	case active.signKey == nil:
+		return nil, fmt.Errorf("active key %q has no private key", cfg.Active)
+	case active.retired(time.Now()):
+		return nil, fmt.Errorf("active key %q is retired", cfg.Active)
+	}
+	set.active = active
+	return set, nil
+}
+
+func parseKey(cfg KeyConfig) (*tokenKey, error) {
+	key := &tokenKey{id: cfg.ID, retireAt: cfg.RetireAt}
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if len(cfg.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret)
+		key.verifyKey = key.signKey
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKey != "" {
+			private, err := jwt.ParseEdPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = private.(ed25519.PrivateKey).Public()
+		} else if cfg.PublicKey != "" {
+			public, err := jwt.ParseEdPublicKeyFromPEM([]byte(cfg.PublicKey))
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+		var public *rsa.PublicKey
+		if cfg.PrivateKey != "" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			public = &private.PublicKey
+		} else if cfg.PublicKey != "" {
+			var err error
+			if public, err = jwt.ParseRSAPublicKeyFromPEM([]byte(cfg.PublicKey)); err != nil {
+				return nil, err
+			}
+		}
+		if public != nil {
+			if public.N.BitLen() < minRSABits {
+				return nil, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+			}
+			key.verifyKey = public
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", cfg.Algorithm)
+	}
+	if key.verifyKey == nil {
+		return nil, errors.New("private_key or public_key is required")
+	}
+	return key, nil
+}
+
+func hmacKeySet(id, secret string) *keySet {
+	key := &tokenKey{
+		id:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &keySet{active: key, keys: map[string]*tokenKey{id: key}}
+}
+
+// Keyring подписывает токены активным ключом и проверяет их по kid из заголовка.
+// Набор ключей подменяется целиком при перечитывании файла.
+type Keyring struct {
+	set atomic.Pointer[keySet]
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+}
+
+// KeyringOptions — источники ключей в порядке приоритета.
+type KeyringOptions struct {
+	// Path — файл ключей в формате KeyringConfig.
+	Path string
+	// Keys — то же содержимое, переданное через окружение.
+	Keys string
+	// Secret — единственный ключ HS256, как раньше в SECRET_KEY.
+	Secret string
+	// Dev разрешает небезопасный ключ по умолчанию, если другие не заданы.
+	Dev bool
+}
+
+// NewKeyring выбирает первый заданный источник ключей. Без ключей и без режима
+// разработки возвращается ErrNoSigningKey: подписывать куки общеизвестным ключом
+// в рабочем окружении нельзя.
+func NewKeyring(opts KeyringOptions) (*Keyring, error) {
+	switch {
+	case opts.Path != "":
+		return LoadKeyring(opts.Path)
+	case opts.Keys != "":
+		return ParseKeyring([]byte(opts.Keys))
+	case opts.Secret != "":
+		if len(opts.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret key must be at least %d bytes", minSecretLength)
+		}
+		return newKeyring(hmacKeySet(envKeyID, opts.Secret)), nil
+	case opts.Dev:
+		logger.Log.Warn("using insecure development key for auth tokens")
+		return DevKeyring(), nil
+	default:
+		return nil, ErrNoSigningKey
+	}
+}
+
+// DevKeyring возвращает связку с общеизвестным ключом для разработки и тестов.
+func DevKeyring() *Keyring {
+	return newKeyring(hmacKeySet(devKeyID, devSecret))
+}
+
+func ParseKeyring(data []byte) (*Keyring, error) {
+	set, err := parseKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyring(set), nil
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func newKeyring(set *keySet) *Keyring {
+	k := &Keyring{}
+	k.set.Store(set)
+	return k
+}
+
+// Reload перечитывает файл ключей. При ошибке остаются прежние ключи.
+func (k *Keyring) Reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.path == "" {
+		return nil
+	}
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	// Время запоминается и для ошибочного файла, чтобы Watch не повторял ту же ошибку.
+	k.modTime = info.ModTime()
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	set, err := parseKeySet(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", k.path, err)
+	}
+	k.set.Store(set)
+	return nil
+}
+
+// Watch перечитывает файл ключей, когда меняется время его модификации,
+// пока не будет отменён ctx.
+func (k *Keyring) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !k.changed() {
+				continue
+			}
+			if err := k.Reload(); err != nil {
+				logger.Log.Error("failed to reload auth keys", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("auth keys reloaded", zap.String("path", k.path), zap.String("active", k.ActiveKeyID()))
+		}
+	}
+}
+
+func (k *Keyring) changed() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.path == "" {
+		return false
+	}
+	info, err := os.Stat(k.path)
+	return err == nil && !info.ModTime().Equal(k.modTime)
+}
+
+func (k *Keyring) ActiveKeyID() string {
+	return k.set.Load().active.id
+}
+
+// Sign подписывает claims активным ключом и указывает его kid в заголовке.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	active := k.set.Load().active
+	if active.retired(time.Now()) {
+		return "", ErrKeyRetired
+	}
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.id
+	return token.SignedString(active.signKey)
+}
+
+// Parse проверяет подпись ключом из kid. Токены без kid выпущены до появления
+// связки ключей и проверяются активным ключом.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	set := k.set.Load()
+	return jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		key := set.active
+		if kid, exists := t.Header["kid"]; exists {
+			id, _ := kid.(string)
+			if key = set.keys[id]; key == nil {
+				return nil, ErrUnknownKeyID
+			}
+		}
+		if key.retired(time.Now()) {
+			return nil, ErrKeyRetired
+		}
+		// Алгоритм берётся из ключа, а не из токена, иначе открытый ключ RS256
+		// можно было бы подсунуть как секрет HS256.
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key.verifyKey, nil
+	})
+}
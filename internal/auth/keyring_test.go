@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func privateKeyPEM(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func keyringJSON(t *testing.T, cfg KeyringConfig) []byte {
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	return data
+}
+
+func parseUserID(k *Keyring, token string) (string, error) {
+	claims := &Claims{}
+	if _, err := k.Parse(token, claims); err != nil {
+		return "", err
+	}
+	return claims.UserID, nil
+}
+
+func TestKeyringRotation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	oldKey := KeyConfig{ID: "2025-01", Algorithm: AlgHS256, Secret: testSecret}
+	newKey := KeyConfig{ID: "2025-02", Algorithm: AlgEdDSA, PrivateKey: privateKeyPEM(t, edKey)}
+
+	before, err := ParseKeyring(keyringJSON(t, KeyringConfig{Active: "2025-01", Keys: []KeyConfig{oldKey}}))
+	require.NoError(t, err)
+	oldToken, err := before.Sign(Claims{UserID: "alice"})
+	require.NoError(t, err)
+
+	after, err := ParseKeyring(keyringJSON(t, KeyringConfig{Active: "2025-02", Keys: []KeyConfig{newKey, oldKey}}))
+	require.NoError(t, err)
+	newToken, err := after.Sign(Claims{UserID: "bob"})
+	require.NoError(t, err)
+
+	header, _, _ := strings.Cut(newToken, ".")
+	decoded, err := jwt.DecodeSegment(header)
+	require.NoError(t, err)
+	assert.Contains(t, string(decoded), `"kid":"2025-02"`)
+	assert.Contains(t, string(decoded), `"alg":"EdDSA"`)
+
+	// Токены старого ключа принимаются, пока ключ не выведен из оборота.
+	userID, err := parseUserID(after, oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+	userID, err = parseUserID(after, newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", userID)
+	_, err = parseUserID(before, newToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	retireAt := time.Now().Add(-time.Minute)
+	oldKey.RetireAt = &retireAt
+	retired, err := ParseKeyring(keyringJSON(t, KeyringConfig{Active: "2025-02", Keys: []KeyConfig{newKey, oldKey}}))
+	require.NoError(t, err)
+	_, err = parseUserID(retired, oldToken)
+	assert.ErrorIs(t, err, ErrKeyRetired)
+	_, err = parseUserID(retired, newToken)
+	assert.NoError(t, err)
+}
+
+func TestKeyringRS256(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	public := publicKeyPEM(t, &rsaKey.PublicKey)
+
+	signer, err := ParseKeyring(keyringJSON(t, KeyringConfig{Active: "rsa", Keys: []KeyConfig{
+		{ID: "rsa", Algorithm: AlgRS256, PrivateKey: privateKeyPEM(t, rsaKey)},
+	}}))
+	require.NoError(t, err)
+	token, err := signer.Sign(Claims{UserID: "alice"})
+	require.NoError(t, err)
+
+	// Ключ только с открытой частью проверяет токены, но подписывать ими нельзя.
+	verifyOnly := KeyConfig{ID: "rsa", Algorithm: AlgRS256, PublicKey: public}
+	_, err = ParseKeyring(keyringJSON(t, KeyringConfig{Active: "rsa", Keys: []KeyConfig{verifyOnly}}))
+	assert.Error(t, err)
+	verifier, err := ParseKeyring(keyringJSON(t, KeyringConfig{Active: "hmac", Keys: []KeyConfig{
+		{ID: "hmac", Algorithm: AlgHS256, Secret: testSecret},
+		verifyOnly,
+	}}))
+	require.NoError(t, err)
+	userID, err := parseUserID(verifier, token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	// Открытый ключ, использованный как секрет HS256, не проходит проверку.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "mallory"})
+	forged.Header["kid"] = "rsa"
+	forgedToken, err := forged.SignedString([]byte(public))
+	require.NoError(t, err)
+	_, err = parseUserID(verifier, forgedToken)
+	assert.Error(t, err)
+}
+
+func TestParseKeyringRejectsInvalidConfig(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	for name, cfg := range map[string]KeyringConfig{
+		"no keys":        {Active: "a"},
+		"missing active": {Active: "b", Keys: []KeyConfig{{ID: "a", Algorithm: AlgHS256, Secret: testSecret}}},
+		"short secret":   {Active: "a", Keys: []KeyConfig{{ID: "a", Algorithm: AlgHS256, Secret: "short"}}},
+		"unknown alg":    {Active: "a", Keys: []KeyConfig{{ID: "a", Algorithm: "none", Secret: testSecret}}},
+		"weak rsa":       {Active: "a", Keys: []KeyConfig{{ID: "a", Algorithm: AlgRS256, PrivateKey: privateKeyPEM(t, rsaKey)}}},
+		"duplicate kid": {Active: "a", Keys: []KeyConfig{
+			{ID: "a", Algorithm: AlgHS256, Secret: testSecret},
+			{ID: "a", Algorithm: AlgHS256, Secret: testSecret},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKeyring(keyringJSON(t, cfg))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewKeyringRequiresKeys(t *testing.T) {
+	_, err := NewKeyring(KeyringOptions{})
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+	_, err = NewKeyring(KeyringOptions{Secret: "supersecretkey"})
+	assert.Error(t, err)
+
+	dev, err := NewKeyring(KeyringOptions{Dev: true})
+	require.NoError(t, err)
+	assert.Equal(t, devKeyID, dev.ActiveKeyID())
+
+	// Заданный ключ важнее режима разработки.
+	env, err := NewKeyring(KeyringOptions{Secret: testSecret, Dev: true})
+	require.NoError(t, err)
+	assert.Equal(t, envKeyID, env.ActiveKeyID())
+
+	// Токены без kid, выпущенные до появления связки, проверяются активным ключом.
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "alice"}).SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	userID, err := parseUserID(env, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+}
+
+func TestKeyringReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	first := KeyConfig{ID: "first", Algorithm: AlgHS256, Secret: testSecret}
+	require.NoError(t, os.WriteFile(path, keyringJSON(t, KeyringConfig{Active: "first", Keys: []KeyConfig{first}}), 0o600))
+
+	k, err := LoadKeyring(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first", k.ActiveKeyID())
+
+	second := KeyConfig{ID: "second", Algorithm: AlgHS256, Secret: strings.Repeat("s", 32)}
+	require.NoError(t, os.WriteFile(path, keyringJSON(t, KeyringConfig{Active: "second", Keys: []KeyConfig{second, first}}), 0o600))
+	require.NoError(t, k.Reload())
+	assert.Equal(t, "second", k.ActiveKeyID())
+
+	// Ошибочный файл не сбрасывает рабочие ключи.
+	require.NoError(t, os.WriteFile(path, []byte(`{"active":"missing"}`), 0o600))
+	assert.Error(t, k.Reload())
+	assert.Equal(t, "second", k.ActiveKeyID())
+}
@@ -0,0 +1,437 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval ограничивает перезагрузку ключей провайдера при токене
+// с незнакомым kid, чтобы поддельные токены не заставляли ходить к провайдеру
+// на каждый запрос.
+const jwksRefreshInterval = time.Minute
+
+const (
+	oidcFlowCookieName = "oidc_flow"
+	oidcFlowAudience   = "oidc-flow"
+	// oidcFlowLifetime — сколько пользователь может провести на странице входа провайдера.
+	oidcFlowLifetime = 10 * time.Minute
+)
+
+// oidcUserPrefix отличает пользователей провайдера от анонимных и зарегистрированных.
+const oidcUserPrefix = "oidc_"
+
+var (
+	ErrOIDCState = errors.New("oidc state mismatch")
+	ErrOIDCNonce = errors.New("oidc nonce mismatch")
+)
+
+// OIDCConfig — настройки клиента провайдера. Без ClientSecret клиент считается
+// публичным и защищён только PKCE.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims — утверждения ID-токена, нужные сервису.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// OIDCProvider реализует вход по authorization code с PKCE. Ключи провайдера
+// загружаются из jwks_uri и перечитываются, когда встречается новый kid.
+type OIDCProvider struct {
+	config    OIDCConfig
+	discovery oidcDiscovery
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewOIDCProvider читает документ discovery провайдера и проверяет, что issuer
+// в нём совпадает с настроенным.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	if config.IssuerURL == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer, client id and redirect url are required")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid"}
+	}
+
+	p := &OIDCProvider{config: config}
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &p.discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(p.discovery.Issuer, "/") != strings.TrimSuffix(config.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", p.discovery.Issuer, config.IssuerURL)
+	}
+	if p.discovery.AuthorizationEndpoint == "" || p.discovery.TokenEndpoint == "" || p.discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: authorization, token and jwks endpoints are required")
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// OIDCFlow — одноразовые значения одного входа, которые живут в куке между
+// переходом к провайдеру и возвратом от него.
+type OIDCFlow struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Claim        bool   `json:"claim,omitempty"`
+}
+
+func NewOIDCFlow() (OIDCFlow, error) {
+	var (
+		flow OIDCFlow
+		err  error
+	)
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.CodeVerifier} {
+		if *value, err = randomToken(32); err != nil {
+			return OIDCFlow{}, err
+		}
+	}
+	return flow, nil
+}
+
+func randomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+type oidcFlowClaims struct {
+	jwt.RegisteredClaims
+	OIDCFlow
+}
+
+// SetOIDCFlowCookie сохраняет значения входа в подписанной куке до возврата от провайдера.
+func SetOIDCFlowCookie(w http.ResponseWriter, flow OIDCFlow) error {
+	if keyring == nil {
+		return errors.New("token signing key is not configured")
+	}
+	now := time.Now()
+	expiresAt := now.Add(oidcFlowLifetime)
+	tokenString, err := keyring.Sign(oidcFlowClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			// Аудитория не даёт выдать куку входа за куку с токеном и наоборот.
+			Audience:  jwt.ClaimStrings{oidcFlowAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		OIDCFlow: flow,
+	})
+	if err != nil {
+		return errors.New("token signing error")
+	}
+	http.SetCookie(w, newOIDCFlowCookie(tokenString, expiresAt))
+	return nil
+}
+
+// ParseOIDCFlowCookie возвращает значения входа и проверяет, что провайдер
+// вернул тот же state.
+func ParseOIDCFlowCookie(r *http.Request, state string) (OIDCFlow, error) {
+	cookie, err := r.Cookie(oidcFlowCookieName)
+	if err != nil || cookie.Value == "" {
+		return OIDCFlow{}, ErrOIDCState
+	}
+	if keyring == nil {
+		return OIDCFlow{}, errors.New("token signing key is not configured")
+	}
+	claims := &oidcFlowClaims{}
+	if _, err := keyring.Parse(cookie.Value, claims); err != nil {
+		return OIDCFlow{}, fmt.Errorf("invalid oidc flow: %w", err)
+	}
+	if !claims.VerifyAudience(oidcFlowAudience, true) || claims.ExpiresAt == nil {
+		return OIDCFlow{}, errors.New("invalid oidc flow")
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return OIDCFlow{}, ErrOIDCState
+	}
+	return claims.OIDCFlow, nil
+}
+
+// ClearOIDCFlowCookie удаляет куку входа: каждый state используется один раз.
+func ClearOIDCFlowCookie(w http.ResponseWriter) {
+	cookie := newOIDCFlowCookie("", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func newOIDCFlowCookie(value string, expires time.Time) *http.Cookie {
+	cookie := newCookie(value, expires)
+	cookie.Name = oidcFlowCookieName
+	// С SameSite=Strict браузер не пришлёт куку при переходе со страницы провайдера.
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	return cookie
+}
+
+// CodeChallenge — PKCE-преобразование S256 от code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера.
+func (p *OIDCProvider) AuthCodeURL(flow OIDCFlow) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {CodeChallenge(flow.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange обменивает код на токены и возвращает проверенные утверждения ID-токена.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, flow OIDCFlow) (*IDTokenClaims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {flow.CodeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// RFC 6749, раздел 2.3.1: идентификатор и секрет кодируются перед Basic.
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("oidc token request failed: %d %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, flow.Nonce)
+}
+
+// VerifyIDToken проверяет подпись ключом провайдера, issuer, audience, срок
+// действия и nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}))
+	_, err := parser.ParseWithClaims(rawToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(p.discovery.Issuer, "/"):
+		return nil, fmt.Errorf("invalid id token: unexpected issuer %q", claims.Issuer)
+	case !claims.VerifyAudience(p.config.ClientID, true):
+		return nil, errors.New("invalid id token: unexpected audience")
+	case claims.ExpiresAt == nil:
+		return nil, errors.New("invalid id token: no expiration")
+	case claims.Subject == "":
+		return nil, errors.New("invalid id token: no subject")
+	case nonce != "" && claims.Nonce != nonce:
+		return nil, ErrOIDCNonce
+	}
+	return claims, nil
+}
+
+// publicKey ищет ключ по kid и один раз перечитывает JWKS, если ключа нет: так
+// подхватывается ротация ключей у провайдера.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, exists := p.keys[kid]; exists {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Ключи неподдерживаемых типов пропускаются, а не ломают загрузку остальных.
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+
+	key, exists := p.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent is too large")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if key.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+		}
+		return key, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("ec point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// OIDCUserID переводит пару issuer и subject в идентификатор пользователя хранилища.
+// Subject уникален только в пределах провайдера, поэтому issuer входит в хэш.
+func OIDCUserID(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(issuer, "/") + "\x00" + subject))
+	return oidcUserPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func IsOIDCUserID(userID string) bool {
+	return strings.HasPrefix(userID, oidcUserPrefix)
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"github.com/AvdeevK/url-cutter.git/internal/auth/oidctest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURL = "http://localhost:8080/api/user/oidc/callback"
+
+func newTestOIDCProvider(t *testing.T, clientSecret string) (*oidctest.Issuer, *OIDCProvider) {
+	issuer, err := oidctest.NewIssuer("url-cutter", clientSecret)
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		IssuerURL:    issuer.URL(),
+		ClientID:     "url-cutter",
+		ClientSecret: clientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+	require.NoError(t, err)
+	return issuer, provider
+}
+
+// authorize проходит вход у провайдера и возвращает код из адреса возврата.
+func authorize(t *testing.T, issuer *oidctest.Issuer, provider *OIDCProvider, flow OIDCFlow, subject string) string {
+	callback, err := issuer.Authorize(provider.AuthCodeURL(flow), subject, subject+"@example.com")
+	require.NoError(t, err)
+	parsed, err := url.Parse(callback)
+	require.NoError(t, err)
+	assert.Equal(t, flow.State, parsed.Query().Get("state"))
+	return parsed.Query().Get("code")
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	for name, secret := range map[string]string{"confidential": "s3cr3t:with/chars", "public": ""} {
+		t.Run(name, func(t *testing.T) {
+			issuer, provider := newTestOIDCProvider(t, secret)
+
+			flow, err := NewOIDCFlow()
+			require.NoError(t, err)
+			authURL, err := url.Parse(provider.AuthCodeURL(flow))
+			require.NoError(t, err)
+			assert.Equal(t, "openid email", authURL.Query().Get("scope"))
+			assert.Equal(t, CodeChallenge(flow.CodeVerifier), authURL.Query().Get("code_challenge"))
+			assert.NotContains(t, authURL.String(), flow.CodeVerifier)
+
+			code := authorize(t, issuer, provider, flow, "alice")
+			claims, err := provider.Exchange(context.Background(), code, flow)
+			require.NoError(t, err)
+			assert.Equal(t, "alice", claims.Subject)
+			assert.Equal(t, "alice@example.com", claims.Email)
+
+			// Код одноразовый.
+			_, err = provider.Exchange(context.Background(), code, flow)
+			assert.Error(t, err)
+
+			// Код, перехваченный без code verifier, не обменять.
+			code = authorize(t, issuer, provider, flow, "alice")
+			stolen := flow
+			stolen.CodeVerifier = "attacker-verifier"
+			_, err = provider.Exchange(context.Background(), code, stolen)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	issuer, provider := newTestOIDCProvider(t, "")
+	now := time.Now()
+	valid := jwt.MapClaims{
+		"iss":   issuer.URL(),
+		"sub":   "alice",
+		"aud":   "url-cutter",
+		"nonce": "nonce",
+		"exp":   now.Add(time.Minute).Unix(),
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+
+	token, err := issuer.SignIDToken(valid)
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(context.Background(), token, "nonce")
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(context.Background(), token, "other")
+	assert.ErrorIs(t, err, ErrOIDCNonce)
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"other issuer":   with("iss", "https://evil.example.com"),
+		"other audience": with("aud", "other-client"),
+		"expired":        with("exp", now.Add(-time.Minute).Unix()),
+		"no subject":     with("sub", ""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, err := issuer.SignIDToken(claims)
+			require.NoError(t, err)
+			_, err = provider.VerifyIDToken(context.Background(), token, "nonce")
+			assert.Error(t, err)
+		})
+	}
+
+	// Токен, подписанный HMAC, не принимается ни с каким ключом.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, valid)
+	forged.Header["kid"] = "key-1"
+	forgedToken, err := forged.SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(context.Background(), forgedToken, "nonce")
+	assert.Error(t, err)
+
+	// После ротации у провайдера ключи перечитываются по новому kid.
+	require.NoError(t, issuer.RotateKey())
+	rotated, err := issuer.SignIDToken(valid)
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(context.Background(), rotated, "nonce")
+	assert.Error(t, err, "jwks is refreshed at most once per interval")
+	provider.fetchedAt = time.Time{}
+	_, err = provider.VerifyIDToken(context.Background(), rotated, "nonce")
+	assert.NoError(t, err)
+}
+
+func TestNewOIDCProviderChecksIssuer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer":"https://other.example.com","authorization_endpoint":"a","token_endpoint":"t","jwks_uri":"j"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		IssuerURL:   server.URL,
+		ClientID:    "url-cutter",
+		RedirectURL: testRedirectURL,
+	})
+	assert.Error(t, err)
+}
+
+func TestOIDCFlowCookie(t *testing.T) {
+	InitializeKeyring(DevKeyring())
+	defer InitializeKeyring(nil)
+
+	flow, err := NewOIDCFlow()
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	require.NoError(t, SetOIDCFlowCookie(w, flow))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	parsed, err := ParseOIDCFlowCookie(r, flow.State)
+	require.NoError(t, err)
+	assert.Equal(t, flow, parsed)
+	_, err = ParseOIDCFlowCookie(r, "forged-state")
+	assert.ErrorIs(t, err, ErrOIDCState)
+
+	// Кука входа не принимается как кука с токеном пользователя.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: cookieName, Value: w.Result().Cookies()[0].Value})
+	_, err = ParseAuthCookie(r)
+	assert.Error(t, err)
+
+	assert.Equal(t, OIDCUserID("https://idp.example.com/", "alice"), OIDCUserID("https://idp.example.com", "alice"))
+	assert.NotEqual(t, OIDCUserID("https://idp.example.com", "alice"), OIDCUserID("https://other.example.com", "alice"))
+	assert.True(t, IsOIDCUserID(OIDCUserID("https://idp.example.com", "alice")))
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength — bcrypt учитывает только первые 72 байта пароля, более
+// длинные пароли отклоняются, а не обрезаются молча.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+)
+
+// dummyHash сравнивается с паролем для несуществующего логина, чтобы по времени
+// ответа нельзя было узнать, зарегистрирован ли логин.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+	switch {
+	case len(password) < MinPasswordLength:
+		return "", ErrPasswordTooShort
+	case len(password) > MaxPasswordLength:
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword сверяет пароль с хэшем; пустой хэш означает, что пользователя нет.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
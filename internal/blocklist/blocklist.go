@@ -0,0 +1,86 @@
+package blocklist
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Blocklist решает, можно ли выдать короткий код. Зарезервированные имена
+// (например, первые сегменты маршрутов) запрещены только целиком, а слова из
+// списка — в любом месте кода. Сравнение не учитывает регистр.
+type Blocklist struct {
+	mu       sync.RWMutex
+	reserved map[string]struct{}
+	words    []string
+}
+
+func New() *Blocklist {
+	return &Blocklist{reserved: make(map[string]struct{})}
+}
+
+// Load читает слова из файла: по одному в строке, пустые строки и строки,
+// начинающиеся с '#', пропускаются.
+func Load(path string) (*Blocklist, error) {
+	b := New()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var words []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	b.AddWords(words...)
+	return b, nil
+}
+
+func (b *Blocklist) Reserve(names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, name := range names {
+		if name != "" {
+			b.reserved[strings.ToLower(name)] = struct{}{}
+		}
+	}
+}
+
+func (b *Blocklist) AddWords(words ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, word := range words {
+		if word != "" {
+			b.words = append(b.words, strings.ToLower(word))
+		}
+	}
+}
+
+func (b *Blocklist) Blocked(code string) bool {
+	code = strings.ToLower(code)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, exists := b.reserved[code]; exists {
+		return true
+	}
+	for _, word := range b.words {
+		if strings.Contains(code, word) {
+			return true
+		}
+	}
+	return false
+}
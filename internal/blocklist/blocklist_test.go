@@ -0,0 +1,37 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# offensive words\nBadWord\n\n  crap  \n"), 0o644))
+
+	b, err := Load(path)
+	require.NoError(t, err)
+
+	assert.True(t, b.Blocked("xxbadwordxx"))
+	assert.True(t, b.Blocked("CRAP1234"))
+	assert.False(t, b.Blocked("offensive"))
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestReservedNamesMatchWholeCode(t *testing.T) {
+	b := New()
+	b.Reserve("api", "ping")
+
+	assert.True(t, b.Blocked("api"))
+	assert.True(t, b.Blocked("PING"))
+	assert.False(t, b.Blocked("rapid"))
+	assert.False(t, b.Blocked("pinger"))
+}
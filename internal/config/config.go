@@ -2,7 +2,10 @@ package config
 
 import (
 	"flag"
+	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 var Configs struct {
@@ -10,6 +13,71 @@ var Configs struct {
 	ResponseAddress string
 	DatabaseAddress string
 	FileStoragePath string
+	SQLitePath      string
+	JanitorInterval time.Duration
+	StorageTimeout  time.Duration
+
+	BatchMaxSize int
+
+	AllowedSchemes      string
+	StripTrackingParams bool
+	MaxURLLength        int
+
+	CodeStrategy       string
+	CodeAlphabet       string
+	CodeLength         int
+	CodeObfuscationKey string
+	BlocklistPath      string
+
+	DomainPolicyPath     string
+	DomainPolicyInterval time.Duration
+	AuditLogPath         string
+	AuditBufferSize      int
+
+	ThreatListPath     string
+	ThreatListInterval time.Duration
+
+	RedirectCode         int
+	PermanentRedirectTTL time.Duration
+
+	ClickBufferSize    int
+	ClickFlushInterval time.Duration
+	TrustedProxies     string
+
+	DeleteQueueSize     int
+	DeleteBatchSize     int
+	DeleteFlushInterval time.Duration
+	DeleteJobRetention  time.Duration
+	ShutdownTimeout     time.Duration
+
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+
+	FileSyncPolicy      string
+	FileSyncInterval    time.Duration
+	FileCompactInterval time.Duration
+
+	RestoreWindow time.Duration
+	PurgeInterval time.Duration
+	AdminToken    string
+
+	AuthKeysPath     string
+	AuthKeysInterval time.Duration
+	AuthKeys         string
+	AuthSecret       string
+	AuthDevKeys      bool
+
+	SessionLifetime time.Duration
+	CookieSecure    bool
+	CookieSameSite  string
+	CookieDomain    string
+
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
 }
 
 func ParseFlags() {
@@ -37,5 +105,292 @@ func ParseFlags() {
 		flag.StringVar(&Configs.DatabaseAddress, "d", "", "database availiable at port")
 	}
 
+	flag.IntVar(&Configs.BatchMaxSize, "batch-max-size", 10000, "max number of urls in one batch request")
+	if envBatchMaxSize := os.Getenv("BATCH_MAX_SIZE"); envBatchMaxSize != "" {
+		Configs.BatchMaxSize = parseIntEnv("BATCH_MAX_SIZE", envBatchMaxSize)
+	}
+
+	flag.StringVar(&Configs.AllowedSchemes, "allowed-schemes", "http,https", "comma separated url schemes allowed for shortening")
+	if envAllowedSchemes := os.Getenv("ALLOWED_SCHEMES"); envAllowedSchemes != "" {
+		Configs.AllowedSchemes = envAllowedSchemes
+	}
+
+	flag.BoolVar(&Configs.StripTrackingParams, "strip-tracking", false, "remove utm_* and click id params from urls (off by default, changes stored and deduplicated urls)")
+	if envStripTracking := os.Getenv("STRIP_TRACKING_PARAMS"); envStripTracking != "" {
+		Configs.StripTrackingParams = parseBoolEnv("STRIP_TRACKING_PARAMS", envStripTracking)
+	}
+
+	flag.IntVar(&Configs.MaxURLLength, "max-url-length", 2048, "max length of url to shorten, 0 disables the limit")
+	if envMaxURLLength := os.Getenv("MAX_URL_LENGTH"); envMaxURLLength != "" {
+		Configs.MaxURLLength = parseIntEnv("MAX_URL_LENGTH", envMaxURLLength)
+	}
+
+	flag.StringVar(&Configs.CodeStrategy, "code-strategy", "random", "short code generation strategy: random or sequential")
+	if envCodeStrategy := os.Getenv("CODE_STRATEGY"); envCodeStrategy != "" {
+		Configs.CodeStrategy = envCodeStrategy
+	}
+
+	flag.StringVar(&Configs.CodeAlphabet, "code-alphabet", "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", "alphabet of generated short codes")
+	if envCodeAlphabet := os.Getenv("CODE_ALPHABET"); envCodeAlphabet != "" {
+		Configs.CodeAlphabet = envCodeAlphabet
+	}
+
+	flag.IntVar(&Configs.CodeLength, "code-length", 8, "length of generated short codes, minimal length for sequential codes")
+	if envCodeLength := os.Getenv("CODE_LENGTH"); envCodeLength != "" {
+		Configs.CodeLength = parseIntEnv("CODE_LENGTH", envCodeLength)
+	}
+
+	flag.StringVar(&Configs.CodeObfuscationKey, "code-obfuscation-key", "", "secret key that shuffles sequential codes, empty keeps them in order")
+	if envCodeObfuscationKey := os.Getenv("CODE_OBFUSCATION_KEY"); envCodeObfuscationKey != "" {
+		Configs.CodeObfuscationKey = envCodeObfuscationKey
+	}
+
+	flag.StringVar(&Configs.BlocklistPath, "blocklist", "", "path to file with words not allowed in short codes and aliases")
+	if envBlocklistPath := os.Getenv("BLOCKLIST_PATH"); envBlocklistPath != "" {
+		Configs.BlocklistPath = envBlocklistPath
+	}
+
+	flag.StringVar(&Configs.DomainPolicyPath, "domain-policy", "", "path to file with allowed and denied destination domains")
+	if envDomainPolicyPath := os.Getenv("DOMAIN_POLICY_PATH"); envDomainPolicyPath != "" {
+		Configs.DomainPolicyPath = envDomainPolicyPath
+	}
+
+	flag.DurationVar(&Configs.DomainPolicyInterval, "domain-policy-interval", 10*time.Second, "interval of checking domain policy file for changes, 0 disables reload")
+	if envDomainPolicyInterval := os.Getenv("DOMAIN_POLICY_INTERVAL"); envDomainPolicyInterval != "" {
+		Configs.DomainPolicyInterval = parseDurationEnv("DOMAIN_POLICY_INTERVAL", envDomainPolicyInterval)
+	}
+
+	flag.StringVar(&Configs.AuditLogPath, "audit-log", "", "path to file with audit trail of blocked attempts")
+	if envAuditLogPath := os.Getenv("AUDIT_LOG_PATH"); envAuditLogPath != "" {
+		Configs.AuditLogPath = envAuditLogPath
+	}
+
+	flag.IntVar(&Configs.AuditBufferSize, "audit-buffer", 1000, "number of recent audit events kept for admin api")
+	if envAuditBufferSize := os.Getenv("AUDIT_BUFFER_SIZE"); envAuditBufferSize != "" {
+		Configs.AuditBufferSize = parseIntEnv("AUDIT_BUFFER_SIZE", envAuditBufferSize)
+	}
+
+	flag.StringVar(&Configs.ThreatListPath, "threat-list", "", "path to local threat list in safe browsing v4 update format, only full 32-byte hashes flag links")
+	if envThreatListPath := os.Getenv("THREAT_LIST_PATH"); envThreatListPath != "" {
+		Configs.ThreatListPath = envThreatListPath
+	}
+
+	flag.DurationVar(&Configs.ThreatListInterval, "threat-list-interval", time.Minute, "interval of checking threat list file for updates, 0 disables reload")
+	if envThreatListInterval := os.Getenv("THREAT_LIST_INTERVAL"); envThreatListInterval != "" {
+		Configs.ThreatListInterval = parseDurationEnv("THREAT_LIST_INTERVAL", envThreatListInterval)
+	}
+
+	flag.IntVar(&Configs.RedirectCode, "redirect-code", 307, "default redirect status code: 301, 302, 307 or 308")
+	if envRedirectCode := os.Getenv("REDIRECT_CODE"); envRedirectCode != "" {
+		Configs.RedirectCode = parseIntEnv("REDIRECT_CODE", envRedirectCode)
+	}
+
+	flag.DurationVar(&Configs.PermanentRedirectTTL, "permanent-redirect-ttl", 24*time.Hour, "max-age of cached permanent redirects")
+	if envPermanentRedirectTTL := os.Getenv("PERMANENT_REDIRECT_TTL"); envPermanentRedirectTTL != "" {
+		Configs.PermanentRedirectTTL = parseDurationEnv("PERMANENT_REDIRECT_TTL", envPermanentRedirectTTL)
+	}
+
+	flag.StringVar(&Configs.SQLitePath, "sqlite", "", "sqlite database path, used when database dsn is empty")
+	if envSQLitePath := os.Getenv("SQLITE_PATH"); envSQLitePath != "" {
+		Configs.SQLitePath = envSQLitePath
+	}
+
+	flag.IntVar(&Configs.CacheSize, "cache-size", 10000, "max number of cached short urls, 0 disables cache")
+	if envCacheSize := os.Getenv("CACHE_SIZE"); envCacheSize != "" {
+		Configs.CacheSize = parseIntEnv("CACHE_SIZE", envCacheSize)
+	}
+
+	flag.DurationVar(&Configs.CacheTTL, "cache-ttl", 5*time.Minute, "ttl of cached short urls")
+	if envCacheTTL := os.Getenv("CACHE_TTL"); envCacheTTL != "" {
+		Configs.CacheTTL = parseDurationEnv("CACHE_TTL", envCacheTTL)
+	}
+
+	flag.DurationVar(&Configs.CacheNegativeTTL, "cache-negative-ttl", 5*time.Second, "ttl of cached lookups of unknown short urls")
+	if envCacheNegativeTTL := os.Getenv("CACHE_NEGATIVE_TTL"); envCacheNegativeTTL != "" {
+		Configs.CacheNegativeTTL = parseDurationEnv("CACHE_NEGATIVE_TTL", envCacheNegativeTTL)
+	}
+
+	flag.StringVar(&Configs.FileSyncPolicy, "file-sync", "interval", "fsync policy of file storage: always, interval or never")
+	if envFileSyncPolicy := os.Getenv("FILE_SYNC"); envFileSyncPolicy != "" {
+		Configs.FileSyncPolicy = envFileSyncPolicy
+	}
+
+	flag.DurationVar(&Configs.FileSyncInterval, "file-sync-interval", time.Second, "interval of fsync for interval file sync policy")
+	if envFileSyncInterval := os.Getenv("FILE_SYNC_INTERVAL"); envFileSyncInterval != "" {
+		Configs.FileSyncInterval = parseDurationEnv("FILE_SYNC_INTERVAL", envFileSyncInterval)
+	}
+
+	flag.DurationVar(&Configs.FileCompactInterval, "file-compact-interval", 10*time.Minute, "interval of file storage compaction, 0 disables it")
+	if envFileCompactInterval := os.Getenv("FILE_COMPACT_INTERVAL"); envFileCompactInterval != "" {
+		Configs.FileCompactInterval = parseDurationEnv("FILE_COMPACT_INTERVAL", envFileCompactInterval)
+	}
+
+	flag.DurationVar(&Configs.StorageTimeout, "storage-timeout", 3*time.Second, "timeout of a single storage operation")
+	if envStorageTimeout := os.Getenv("STORAGE_TIMEOUT"); envStorageTimeout != "" {
+		Configs.StorageTimeout = parseDurationEnv("STORAGE_TIMEOUT", envStorageTimeout)
+	}
+
+	flag.DurationVar(&Configs.JanitorInterval, "janitor-interval", time.Minute, "interval of marking expired urls as deleted")
+	if envJanitorInterval := os.Getenv("JANITOR_INTERVAL"); envJanitorInterval != "" {
+		Configs.JanitorInterval = parseDurationEnv("JANITOR_INTERVAL", envJanitorInterval)
+	}
+
+	flag.IntVar(&Configs.ClickBufferSize, "click-buffer", 10000, "size of click events buffer")
+	if envClickBufferSize := os.Getenv("CLICK_BUFFER_SIZE"); envClickBufferSize != "" {
+		Configs.ClickBufferSize = parseIntEnv("CLICK_BUFFER_SIZE", envClickBufferSize)
+	}
+
+	flag.DurationVar(&Configs.ClickFlushInterval, "click-flush-interval", time.Second, "interval of saving click events")
+	if envClickFlushInterval := os.Getenv("CLICK_FLUSH_INTERVAL"); envClickFlushInterval != "" {
+		Configs.ClickFlushInterval = parseDurationEnv("CLICK_FLUSH_INTERVAL", envClickFlushInterval)
+	}
+
+	flag.StringVar(&Configs.TrustedProxies, "trusted-proxies", "", "comma separated proxy addresses or subnets allowed to set X-Forwarded-For, empty ignores the header")
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		Configs.TrustedProxies = envTrustedProxies
+	}
+
+	flag.IntVar(&Configs.DeleteQueueSize, "delete-queue", 1000, "size of deletion queue")
+	if envDeleteQueueSize := os.Getenv("DELETE_QUEUE_SIZE"); envDeleteQueueSize != "" {
+		Configs.DeleteQueueSize = parseIntEnv("DELETE_QUEUE_SIZE", envDeleteQueueSize)
+	}
+
+	flag.IntVar(&Configs.DeleteBatchSize, "delete-batch", 1000, "max number of urls deleted in one batch")
+	if envDeleteBatchSize := os.Getenv("DELETE_BATCH_SIZE"); envDeleteBatchSize != "" {
+		Configs.DeleteBatchSize = parseIntEnv("DELETE_BATCH_SIZE", envDeleteBatchSize)
+	}
+
+	flag.DurationVar(&Configs.DeleteFlushInterval, "delete-flush-interval", time.Second, "interval of flushing deletion queue")
+	if envDeleteFlushInterval := os.Getenv("DELETE_FLUSH_INTERVAL"); envDeleteFlushInterval != "" {
+		Configs.DeleteFlushInterval = parseDurationEnv("DELETE_FLUSH_INTERVAL", envDeleteFlushInterval)
+	}
+
+	flag.DurationVar(&Configs.DeleteJobRetention, "delete-job-retention", time.Hour, "how long finished deletion jobs are kept for status requests")
+	if envDeleteJobRetention := os.Getenv("DELETE_JOB_RETENTION"); envDeleteJobRetention != "" {
+		Configs.DeleteJobRetention = parseDurationEnv("DELETE_JOB_RETENTION", envDeleteJobRetention)
+	}
+
+	flag.DurationVar(&Configs.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "timeout of graceful shutdown")
+	if envShutdownTimeout := os.Getenv("SHUTDOWN_TIMEOUT"); envShutdownTimeout != "" {
+		Configs.ShutdownTimeout = parseDurationEnv("SHUTDOWN_TIMEOUT", envShutdownTimeout)
+	}
+
+	flag.DurationVar(&Configs.RestoreWindow, "restore-window", 24*time.Hour, "period during which deleted urls can be restored")
+	if envRestoreWindow := os.Getenv("RESTORE_WINDOW"); envRestoreWindow != "" {
+		Configs.RestoreWindow = parseDurationEnv("RESTORE_WINDOW", envRestoreWindow)
+	}
+
+	flag.DurationVar(&Configs.PurgeInterval, "purge-interval", 0, "interval of purging deleted urls, 0 disables scheduled purge")
+	if envPurgeInterval := os.Getenv("PURGE_INTERVAL"); envPurgeInterval != "" {
+		Configs.PurgeInterval = parseDurationEnv("PURGE_INTERVAL", envPurgeInterval)
+	}
+
+	flag.StringVar(&Configs.AdminToken, "admin-token", "", "token for admin endpoints, empty disables them")
+	if envAdminToken := os.Getenv("ADMIN_TOKEN"); envAdminToken != "" {
+		Configs.AdminToken = envAdminToken
+	}
+
+	flag.StringVar(&Configs.AuthKeysPath, "auth-keys", "", "path to json file with auth token signing keys")
+	if envAuthKeysPath := os.Getenv("AUTH_KEYS_FILE"); envAuthKeysPath != "" {
+		Configs.AuthKeysPath = envAuthKeysPath
+	}
+
+	flag.DurationVar(&Configs.AuthKeysInterval, "auth-keys-interval", time.Minute, "interval of checking auth keys file for changes, 0 disables reload")
+	if envAuthKeysInterval := os.Getenv("AUTH_KEYS_INTERVAL"); envAuthKeysInterval != "" {
+		Configs.AuthKeysInterval = parseDurationEnv("AUTH_KEYS_INTERVAL", envAuthKeysInterval)
+	}
+
+	// Сами ключи передаются только через окружение, чтобы не светиться в списке процессов.
+	Configs.AuthKeys = os.Getenv("AUTH_KEYS")
+	Configs.AuthSecret = os.Getenv("SECRET_KEY")
+
+	flag.BoolVar(&Configs.AuthDevKeys, "auth-dev-keys", false, "allow insecure built-in auth key when no keys are configured, for development only")
+	if envAuthDevKeys := os.Getenv("AUTH_DEV_KEYS"); envAuthDevKeys != "" {
+		Configs.AuthDevKeys = parseBoolEnv("AUTH_DEV_KEYS", envAuthDevKeys)
+	}
+
+	flag.DurationVar(&Configs.SessionLifetime, "session-lifetime", 3*time.Hour, "lifetime of auth token, renewed while user is active")
+	if envSessionLifetime := os.Getenv("SESSION_LIFETIME"); envSessionLifetime != "" {
+		Configs.SessionLifetime = parseDurationEnv("SESSION_LIFETIME", envSessionLifetime)
+	}
+
+	flag.BoolVar(&Configs.CookieSecure, "cookie-secure", false, "send auth cookie over https only")
+	if envCookieSecure := os.Getenv("COOKIE_SECURE"); envCookieSecure != "" {
+		Configs.CookieSecure = parseBoolEnv("COOKIE_SECURE", envCookieSecure)
+	}
+
+	flag.StringVar(&Configs.CookieSameSite, "cookie-samesite", "lax", "SameSite attribute of auth cookie: lax, strict or none")
+	if envCookieSameSite := os.Getenv("COOKIE_SAMESITE"); envCookieSameSite != "" {
+		Configs.CookieSameSite = envCookieSameSite
+	}
+
+	flag.StringVar(&Configs.CookieDomain, "cookie-domain", "", "domain attribute of auth cookie, empty binds it to the request host")
+	if envCookieDomain := os.Getenv("COOKIE_DOMAIN"); envCookieDomain != "" {
+		Configs.CookieDomain = envCookieDomain
+	}
+
+	flag.StringVar(&Configs.OIDCIssuerURL, "oidc-issuer", "", "openid connect provider url, empty disables sign in with provider")
+	if envOIDCIssuerURL := os.Getenv("OIDC_ISSUER_URL"); envOIDCIssuerURL != "" {
+		Configs.OIDCIssuerURL = envOIDCIssuerURL
+	}
+
+	flag.StringVar(&Configs.OIDCClientID, "oidc-client-id", "", "client id registered at openid connect provider")
+	if envOIDCClientID := os.Getenv("OIDC_CLIENT_ID"); envOIDCClientID != "" {
+		Configs.OIDCClientID = envOIDCClientID
+	}
+
+	// Секрет клиента, как и ключи подписи, задаётся только через окружение.
+	Configs.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+
+	flag.StringVar(&Configs.OIDCRedirectURL, "oidc-redirect-url", "", "callback url registered at openid connect provider, defaults to base url")
+	if envOIDCRedirectURL := os.Getenv("OIDC_REDIRECT_URL"); envOIDCRedirectURL != "" {
+		Configs.OIDCRedirectURL = envOIDCRedirectURL
+	}
+
+	flag.StringVar(&Configs.OIDCScopes, "oidc-scopes", "openid email", "space separated scopes requested from openid connect provider")
+	if envOIDCScopes := os.Getenv("OIDC_SCOPES"); envOIDCScopes != "" {
+		Configs.OIDCScopes = envOIDCScopes
+	}
+
 	flag.Parse()
+
+	// Запись переходов и очередь удаления работают всегда, поэтому 0 здесь
+	// не может означать «выключено», как у janitor-interval и purge-interval.
+	requirePositive("click-buffer", "CLICK_BUFFER_SIZE", Configs.ClickBufferSize)
+	requirePositive("click-flush-interval", "CLICK_FLUSH_INTERVAL", Configs.ClickFlushInterval)
+	requirePositive("delete-queue", "DELETE_QUEUE_SIZE", Configs.DeleteQueueSize)
+	requirePositive("delete-batch", "DELETE_BATCH_SIZE", Configs.DeleteBatchSize)
+	requirePositive("delete-flush-interval", "DELETE_FLUSH_INTERVAL", Configs.DeleteFlushInterval)
+}
+
+func parseDurationEnv(name, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid duration in %s: %v", name, err)
+	}
+	return d
+}
+
+// requirePositive проверяет значение после разбора флагов, так как флаг
+// переопределяет переменную окружения.
+func requirePositive[T int | time.Duration](flagName, envName string, value T) {
+	if value <= 0 {
+		log.Fatalf("invalid value of -%s (%s): must be positive, got %v", flagName, envName, value)
+	}
+}
+
+func parseBoolEnv(name, value string) bool {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid boolean in %s: %v", name, err)
+	}
+	return b
+}
+
+func parseIntEnv(name, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid integer in %s: %v", name, err)
+	}
+	return n
 }
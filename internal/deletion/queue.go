@@ -0,0 +1,381 @@
+package deletion
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull   = errors.New("deletion queue is full")
+	ErrQueueClosed = errors.New("deletion queue is closed")
+	ErrJobNotFound = errors.New("deletion job not found")
+)
+
+const (
+	// maxFlushAttempts — после стольких неудачных попыток задача показывается
+	// пользователю проваленной, но остаётся в хранилище и продолжает повторяться.
+	maxFlushAttempts = 3
+	// maxRetryDelay ограничивает рост паузы между попытками при недоступном хранилище.
+	maxRetryDelay = time.Minute
+)
+
+// Queue принимает запросы на удаление от многих пользователей и раз в flushInterval
+// сливает их в один вызов MarkURLsAsDeleted. Каждая задача сначала сохраняется
+// в хранилище, поэтому незавершённые удаления переживают перезапуск.
+type Queue struct {
+	store         storage.Storage
+	tasks         chan models.DeletionTask
+	flushInterval time.Duration
+	batchSize     int
+	// failures — неудачи подряд, от них зависит пауза до следующей попытки.
+	failures int
+	retryAt  time.Time
+	// attempts — неудачные попытки по каждой задаче.
+	attempts map[string]int
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	jobsMu       sync.Mutex
+	jobs         map[string]*models.DeletionJob
+	jobRetention time.Duration
+}
+
+// NewQueue отказывается от неположительных размеров и интервала: с ними Run
+// паникует или перестаёт читать канал, и очередь навсегда переполняется.
+func NewQueue(store storage.Storage, size int, batchSize int, flushInterval, jobRetention time.Duration) (*Queue, error) {
+	switch {
+	case size <= 0:
+		return nil, fmt.Errorf("deletion queue size must be positive, got %d", size)
+	case batchSize <= 0:
+		return nil, fmt.Errorf("deletion batch size must be positive, got %d", batchSize)
+	case flushInterval <= 0:
+		return nil, fmt.Errorf("deletion flush interval must be positive, got %v", flushInterval)
+	}
+	return &Queue{
+		store:         store,
+		tasks:         make(chan models.DeletionTask, size),
+		flushInterval: flushInterval,
+		batchSize:     batchSize,
+		attempts:      make(map[string]int),
+		done:          make(chan struct{}),
+		jobs:          make(map[string]*models.DeletionJob),
+		jobRetention:  jobRetention,
+	}, nil
+}
+
+func (q *Queue) Enqueue(ctx context.Context, userID string, shortURLs []string) (models.DeletionTask, error) {
+	task := models.DeletionTask{
+		UserID:    userID,
+		ShortURLs: shortURLs,
+		CreatedAt: time.Now().UTC(),
+	}
+	id, err := newTaskID()
+	if err != nil {
+		return task, err
+	}
+	task.ID = id
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return task, ErrQueueClosed
+	}
+	if err := q.store.SaveDeletionTask(ctx, task); err != nil {
+		return task, err
+	}
+
+	// Задача регистрируется до отправки в канал, иначе Run может обработать её раньше.
+	q.trackJob(task)
+	select {
+	case q.tasks <- task:
+		return task, nil
+	default:
+		q.forgetJob(task.ID)
+		if err := q.store.RemoveDeletionTasks(ctx, []string{task.ID}); err != nil {
+			logger.Log.Error("failed to remove rejected deletion task", zap.String("task", task.ID), zap.Error(err))
+		}
+		return task, ErrQueueFull
+	}
+}
+
+// Run обрабатывает задачи, оставшиеся с прошлого запуска, и затем новые задачи
+// до вызова Shutdown, после чего дочищает очередь и завершается.
+func (q *Queue) Run() {
+	defer close(q.done)
+
+	pending, backlog := q.recover()
+	// Задача, поставленная до чтения сохранённых задач, попадает и в recover,
+	// и в канал; второй раз её обрабатывать не нужно. Такие задачи могут быть
+	// только среди первых backlog задач канала, после них карта не нужна.
+	recovered := make(map[string]struct{}, len(pending))
+	for _, task := range pending {
+		recovered[task.ID] = struct{}{}
+	}
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		// Пока накопленное не удаётся сбросить, новые задачи не читаются,
+		// и при заполнении канала Enqueue начинает отказывать.
+		tasks := q.tasks
+		if countURLs(pending) >= q.batchSize {
+			tasks = nil
+		}
+
+		select {
+		case task, ok := <-tasks:
+			if !ok {
+				q.flush(pending)
+				return
+			}
+			if backlog > 0 {
+				backlog--
+				_, duplicate := recovered[task.ID]
+				if backlog == 0 {
+					recovered = nil
+				}
+				if duplicate {
+					continue
+				}
+			}
+			pending = append(pending, task)
+			if countURLs(pending) >= q.batchSize && !q.backingOff() {
+				pending = q.flush(pending)
+			}
+		case <-ticker.C:
+			if !q.backingOff() {
+				pending = q.flush(pending)
+			}
+		}
+	}
+}
+
+// Job возвращает состояние задачи удаления, если она принадлежит пользователю.
+func (q *Queue) Job(userID, id string) (models.DeletionJob, error) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	job, exists := q.jobs[id]
+	if !exists || job.UserID != userID {
+		return models.DeletionJob{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+func (q *Queue) trackJob(task models.DeletionTask) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	if _, exists := q.jobs[task.ID]; exists {
+		return
+	}
+	q.jobs[task.ID] = &models.DeletionJob{
+		ID:        task.ID,
+		UserID:    task.UserID,
+		State:     models.JobStateQueued,
+		Requested: len(task.ShortURLs),
+		CreatedAt: task.CreatedAt,
+	}
+}
+
+func (q *Queue) forgetJob(id string) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	delete(q.jobs, id)
+}
+
+func (q *Queue) setJobsState(tasks []models.DeletionTask, state string) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	for _, task := range tasks {
+		// Проваленная задача повторяется молча, пока не завершится успехом.
+		if job, exists := q.jobs[task.ID]; exists && job.State != models.JobStateFailed {
+			job.State = state
+		}
+	}
+}
+
+func (q *Queue) finishJobs(tasks []models.DeletionTask, results []models.DeletionResult, flushErr error) {
+	statuses := make(map[models.URLToDelete]string, len(results))
+	for _, result := range results {
+		statuses[models.URLToDelete{UserID: result.UserID, ShortURL: result.ShortURL}] = result.Status
+	}
+
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	now := time.Now().UTC()
+	for _, task := range tasks {
+		job, exists := q.jobs[task.ID]
+		if !exists {
+			continue
+		}
+		job.FinishedAt = &now
+		if flushErr != nil {
+			job.State = models.JobStateFailed
+			job.Error = flushErr.Error()
+			continue
+		}
+		job.State = models.JobStateDone
+		job.Error = ""
+		for _, shortURL := range task.ShortURLs {
+			switch statuses[models.URLToDelete{UserID: task.UserID, ShortURL: shortURL}] {
+			case models.DeletionStatusDeleted:
+				job.Deleted++
+			case models.DeletionStatusNotOwned:
+				job.NotOwned++
+			default:
+				job.NotFound++
+			}
+		}
+	}
+
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > q.jobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// Shutdown перестаёт принимать задачи и ждёт, пока очередь будет обработана.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.tasks)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recover загружает сохранённые задачи и возвращает, сколько задач к этому моменту
+// уже лежит в канале. Enqueue держит блокировку от сохранения задачи до отправки
+// в канал, поэтому задачи, поставленные позже, в сохранённые не попадают.
+func (q *Queue) recover() ([]models.DeletionTask, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	backlog := len(q.tasks)
+	ctx, cancel := storage.OperationContext(context.Background())
+	defer cancel()
+
+	tasks, err := q.store.GetPendingDeletionTasks(ctx)
+	if err != nil {
+		logger.Log.Error("failed to load pending deletion tasks", zap.Error(err))
+		return nil, 0
+	}
+	if len(tasks) > 0 {
+		logger.Log.Info("recovered pending deletion tasks", zap.Int("count", len(tasks)))
+	}
+	for _, task := range tasks {
+		q.trackJob(task)
+	}
+	return tasks, backlog
+}
+
+// flush возвращает задачи, которые не удалось обработать и нужно повторить.
+func (q *Queue) flush(pending []models.DeletionTask) []models.DeletionTask {
+	if len(pending) == 0 {
+		return pending
+	}
+
+	ctx, cancel := storage.OperationContext(context.Background())
+	defer cancel()
+
+	urls := make([]models.URLToDelete, 0, countURLs(pending))
+	ids := make([]string, 0, len(pending))
+	for _, task := range pending {
+		for _, shortURL := range task.ShortURLs {
+			urls = append(urls, models.URLToDelete{UserID: task.UserID, ShortURL: shortURL})
+		}
+		ids = append(ids, task.ID)
+	}
+
+	q.setJobsState(pending, models.JobStateRunning)
+	results, err := q.store.MarkURLsAsDeleted(ctx, urls)
+	if err != nil {
+		// Задачи остаются в хранилище и в очереди: удаление, принятое у пользователя,
+		// не теряется, сколько бы ни длился сбой.
+		q.retryLater(pending, err)
+		return pending
+	}
+	q.failures = 0
+	q.retryAt = time.Time{}
+	for _, id := range ids {
+		delete(q.attempts, id)
+	}
+	q.finishJobs(pending, results, nil)
+
+	if err := q.store.RemoveDeletionTasks(ctx, ids); err != nil {
+		// Повторное удаление идемпотентно, поэтому задачи просто обработаются ещё раз после перезапуска.
+		logger.Log.Error("failed to remove processed deletion tasks", zap.Error(err))
+	}
+	logger.Log.Info("deletion tasks processed", zap.Int("tasks", len(pending)), zap.Int("urls", len(urls)))
+	return pending[:0]
+}
+
+// retryLater откладывает следующую попытку с растущей паузой. Задачи, исчерпавшие
+// maxFlushAttempts, показываются проваленными, но продолжают повторяться.
+func (q *Queue) retryLater(pending []models.DeletionTask, err error) {
+	q.failures++
+	delay := q.flushInterval << (q.failures - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	q.retryAt = time.Now().Add(delay)
+
+	var failed []models.DeletionTask
+	for _, task := range pending {
+		q.attempts[task.ID]++
+		if q.attempts[task.ID] == maxFlushAttempts {
+			failed = append(failed, task)
+		}
+	}
+	q.setJobsState(pending, models.JobStateQueued)
+	if len(failed) > 0 {
+		q.finishJobs(failed, nil, err)
+	}
+	logger.Log.Error("failed to mark urls as deleted, will retry",
+		zap.Int("tasks", len(pending)), zap.Duration("delay", delay), zap.Error(err))
+}
+
+func (q *Queue) backingOff() bool {
+	return time.Now().Before(q.retryAt)
+}
+
+func countURLs(tasks []models.DeletionTask) int {
+	count := 0
+	for _, task := range tasks {
+		count += len(task.ShortURLs)
+	}
+	return count
+}
+
+func newTaskID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,242 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingStorage struct {
+	*storage.MemoryStorage
+	calls int
+}
+
+func (c *countingStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	c.calls++
+	return c.MemoryStorage.MarkURLsAsDeleted(ctx, urls)
+}
+
+func saveURLs(t *testing.T, s storage.Storage, userID string, count int) []string {
+	ids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("%s-%d", userID, i)
+		err := s.SaveURL(context.Background(), models.AddNewURLRecord{
+			ShortURL:    id,
+			OriginalURL: "https://example.com/" + id,
+			UserID:      userID,
+		})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func newTestQueue(t *testing.T, s storage.Storage, size, batchSize int, flushInterval, jobRetention time.Duration) *Queue {
+	q, err := NewQueue(s, size, batchSize, flushInterval, jobRetention)
+	if err != nil {
+		t.Fatalf("failed to create deletion queue: %v", err)
+	}
+	return q
+}
+
+func TestNewQueueRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		batchSize     int
+		flushInterval time.Duration
+	}{
+		{name: "zero queue size", size: 0, batchSize: 100, flushInterval: time.Second},
+		{name: "negative queue size", size: -1, batchSize: 100, flushInterval: time.Second},
+		{name: "zero batch size", size: 10, batchSize: 0, flushInterval: time.Second},
+		{name: "negative batch size", size: 10, batchSize: -5, flushInterval: time.Second},
+		{name: "zero flush interval", size: 10, batchSize: 100, flushInterval: 0},
+		{name: "negative flush interval", size: 10, batchSize: 100, flushInterval: -time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := NewQueue(storage.NewMemoryStorage(), test.size, test.batchSize, test.flushInterval, time.Hour)
+			assert.Error(t, err)
+			assert.Nil(t, q)
+		})
+	}
+}
+
+func TestQueueCoalescesUsersIntoOneBatch(t *testing.T) {
+	s := &countingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	alice := saveURLs(t, s, "alice", 3)
+	bob := saveURLs(t, s, "bob", 2)
+
+	q := newTestQueue(t, s, 10, 100, time.Hour, time.Hour)
+	go q.Run()
+
+	_, err := q.Enqueue(context.Background(), "alice", alice)
+	assert.NoError(t, err)
+	_, err = q.Enqueue(context.Background(), "bob", bob)
+	assert.NoError(t, err)
+	// Чужая ссылка не должна удаляться.
+	_, err = q.Enqueue(context.Background(), "bob", alice[:1])
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Shutdown(context.Background()))
+	assert.Equal(t, 1, s.calls)
+
+	for _, id := range append(alice, bob...) {
+		assert.ErrorIs(t, s.GetOriginalURL(context.Background(), id).Error, storage.ErrGone)
+	}
+	pending, err := s.GetPendingDeletionTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = q.Enqueue(context.Background(), "alice", alice)
+	assert.True(t, errors.Is(err, ErrQueueClosed))
+}
+
+func TestQueueRecoversPersistedTasks(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	ids := saveURLs(t, s, "alice", 2)
+
+	err := s.SaveDeletionTask(context.Background(), models.DeletionTask{
+		ID:        "left-from-previous-run",
+		UserID:    "alice",
+		ShortURLs: ids,
+		CreatedAt: time.Now(),
+	})
+	assert.NoError(t, err)
+
+	q := newTestQueue(t, s, 10, 100, time.Hour, time.Hour)
+	go q.Run()
+	assert.NoError(t, q.Shutdown(context.Background()))
+
+	for _, id := range ids {
+		assert.ErrorIs(t, s.GetOriginalURL(context.Background(), id).Error, storage.ErrGone)
+	}
+}
+
+func TestQueueProcessesTasksEnqueuedBeforeRunOnce(t *testing.T) {
+	s := &countingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	alice := saveURLs(t, s, "alice", 2)
+	bob := saveURLs(t, s, "bob", 1)
+
+	// Задачи уже сохранены и лежат в канале, поэтому recover тоже их видит.
+	q := newTestQueue(t, s, 10, 100, time.Hour, time.Hour)
+	aliceTask, err := q.Enqueue(context.Background(), "alice", alice)
+	assert.NoError(t, err)
+	bobTask, err := q.Enqueue(context.Background(), "bob", bob)
+	assert.NoError(t, err)
+
+	go q.Run()
+	assert.NoError(t, q.Shutdown(context.Background()))
+	assert.Equal(t, 1, s.calls)
+
+	for _, task := range []models.DeletionTask{aliceTask, bobTask} {
+		job, err := q.Job(task.UserID, task.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.JobStateDone, job.State)
+		assert.Equal(t, job.Requested, job.Deleted)
+		assert.Zero(t, job.NotFound)
+	}
+}
+
+func TestQueueReportsJobResults(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	alice := saveURLs(t, s, "alice", 2)
+	bob := saveURLs(t, s, "bob", 1)
+
+	q := newTestQueue(t, s, 10, 100, time.Hour, time.Hour)
+	go q.Run()
+
+	task, err := q.Enqueue(context.Background(), "alice", append(alice, bob[0], "missing"))
+	assert.NoError(t, err)
+
+	job, err := q.Job("alice", task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStateQueued, job.State)
+
+	_, err = q.Job("bob", task.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	assert.NoError(t, q.Shutdown(context.Background()))
+
+	job, err = q.Job("alice", task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStateDone, job.State)
+	assert.Equal(t, 4, job.Requested)
+	assert.Equal(t, 2, job.Deleted)
+	assert.Equal(t, 1, job.NotOwned)
+	assert.Equal(t, 1, job.NotFound)
+	assert.NotNil(t, job.FinishedAt)
+}
+
+type failingStorage struct {
+	*storage.MemoryStorage
+	failing atomic.Bool
+}
+
+func (f *failingStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	if f.failing.Load() {
+		return nil, errors.New("storage is unavailable")
+	}
+	return f.MemoryStorage.MarkURLsAsDeleted(ctx, urls)
+}
+
+func TestQueueKeepsTasksWhileStorageFails(t *testing.T) {
+	s := &failingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	s.failing.Store(true)
+	ids := saveURLs(t, s, "alice", 2)
+
+	q := newTestQueue(t, s, 10, 100, 10*time.Millisecond, time.Hour)
+	go q.Run()
+
+	task, err := q.Enqueue(context.Background(), "alice", ids)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		job, err := q.Job("alice", task.ID)
+		return err == nil && job.State == models.JobStateFailed
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Проваленная задача не стирается из хранилища.
+	pending, err := s.GetPendingDeletionTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, task.ID, pending[0].ID)
+
+	s.failing.Store(false)
+	assert.Eventually(t, func() bool {
+		job, err := q.Job("alice", task.ID)
+		return err == nil && job.State == models.JobStateDone
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, q.Shutdown(context.Background()))
+
+	pending, err = s.GetPendingDeletionTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	for _, id := range ids {
+		assert.ErrorIs(t, s.GetOriginalURL(context.Background(), id).Error, storage.ErrGone)
+	}
+}
+
+func TestQueueKeepsTasksFailedAtShutdown(t *testing.T) {
+	s := &failingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	s.failing.Store(true)
+	ids := saveURLs(t, s, "alice", 1)
+
+	q := newTestQueue(t, s, 10, 100, time.Hour, time.Hour)
+	go q.Run()
+	_, err := q.Enqueue(context.Background(), "alice", ids)
+	assert.NoError(t, err)
+	assert.NoError(t, q.Shutdown(context.Background()))
+
+	// Задача дождётся следующего запуска.
+	pending, err := s.GetPendingDeletionTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	minLoginLength = 3
+	maxLoginLength = 64
+)
+
+var errInvalidCredentials = errors.New("invalid login or password")
+
+// RegisterHandler создаёт аккаунт и переносит в него ссылки, созданные до
+// регистрации под анонимной кукой или ключом API.
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+	if length := utf8.RuneCountInString(req.Login); length < minLoginLength || length > maxLoginLength {
+		writeJSONError(w, "login must be from 3 to 64 characters", http.StatusBadRequest)
+		return
+	}
+	passwordHash, err := auth.HashPassword(req.Password)
+	if errors.Is(err, auth.ErrPasswordTooShort) || errors.Is(err, auth.ErrPasswordTooLong) {
+		writeJSONError(w, "password must be from 8 to 72 bytes", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Error hashing password: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	userID, err := auth.GenerateUserID()
+	if err != nil {
+		logger.Log.Error("Error generating user id: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	user := models.User{
+		ID:           userID,
+		Login:        req.Login,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	err = store.CreateUser(ctx, user)
+	if errors.Is(err, storage.ErrLoginTaken) {
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Error creating user: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claimed, err := claimAnonymousURLs(ctx, r, user.ID)
+	if err != nil {
+		// Аккаунт уже создан, поэтому ошибка переноса не отменяет регистрацию.
+		logger.Log.Error("Error claiming anonymous urls: ", zap.Error(err))
+	}
+	writeAccount(w, http.StatusCreated, user, claimed)
+}
+
+// LoginHandler начинает сессию аккаунта. Ссылки текущего анонимного пользователя
+// переносятся, только если об этом попросили явно: войти можно и с чужого браузера.
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	user, err := store.GetUserByLogin(ctx, req.Login)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Log.Error("Error getting user: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, req.Password) {
+		writeJSONError(w, errInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var claimed int64
+	if req.Claim {
+		if claimed, err = claimAnonymousURLs(ctx, r, user.ID); err != nil {
+			logger.Log.Error("Error claiming anonymous urls: ", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	writeAccount(w, http.StatusOK, user, claimed)
+}
+
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (models.CredentialsRequest, bool) {
+	var req models.CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	// Логин не зависит от регистра, чтобы не заводить два аккаунта для одного адреса.
+	req.Login = strings.ToLower(strings.TrimSpace(req.Login))
+	return req, true
+}
+
+// claimAnonymousURLs переносит в аккаунт ссылки пользователя из ключа API или
+// действующей куки, если это не другой аккаунт.
+func claimAnonymousURLs(ctx context.Context, r *http.Request, accountID string) (int64, error) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		claims, err := currentSession(r)
+		if err != nil || claims == nil {
+			return 0, err
+		}
+		userID = claims.UserID
+	}
+	// Пользователь провайдера OIDC — тоже аккаунт, хоть и без записи в хранилище.
+	if userID == accountID || auth.IsOIDCUserID(userID) {
+		return 0, nil
+	}
+
+	_, err := store.GetUser(ctx, userID)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return 0, err
+	}
+	claimed, err := store.ReassignURLs(ctx, userID, accountID)
+	if err == nil && claimed > 0 {
+		logger.Log.Info("anonymous urls claimed", zap.String("user", accountID), zap.Int64("count", claimed))
+	}
+	return claimed, err
+}
+
+func writeAccount(w http.ResponseWriter, status int, user models.User, claimed int64) {
+	if err := auth.SetAuthCookie(w, user.ID); err != nil {
+		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.AccountResponse{User: user, Claimed: claimed}); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
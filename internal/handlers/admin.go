@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// requireAdmin проверяет токен администратора; без настроенного токена админские ручки недоступны.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := r.Header.Get(adminTokenHeader)
+	if config.Configs.AdminToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(config.Configs.AdminToken)) != 1 {
+		writeJSONError(w, "admin token required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func PurgeDeletedURLsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	purged, err := store.PurgeDeletedURLs(ctx, time.Now().Add(-config.Configs.RestoreWindow))
+	if err != nil {
+		logger.Log.Error("Failed to purge deleted URLs", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("deleted urls purged by admin", zap.Int64("count", purged))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(models.PurgeResponse{Purged: purged}); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func GetCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	cached, ok := store.(*storage.CachedStorage)
+	if !ok {
+		writeJSONError(w, "cache is disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(cached.CacheStats()); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
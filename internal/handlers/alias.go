@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/blocklist"
+	"regexp"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 32
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var errAliasBlocked = errors.New("alias is reserved or not allowed")
+
+var blocked = blocklist.New()
+
+func InitializeBlocklist(b *blocklist.Blocklist) {
+	blocked = b
+}
+
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("alias length must be between %d and %d characters", minAliasLength, maxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias may contain only latin letters, digits, '-' and '_'")
+	}
+	if blocked.Blocked(alias) {
+		return errAliasBlocked
+	}
+	return nil
+}
+
+// resolveShortURL проверяет псевдоним; пустой код означает, что его сгенерирует saveURL.
+func resolveShortURL(alias string) (string, error) {
+	if alias == "" {
+		return "", nil
+	}
+	if err := validateAlias(alias); err != nil {
+		return "", err
+	}
+	return alias, nil
+}
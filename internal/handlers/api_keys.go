@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+const maxAPIKeyNameLength = 100
+
+// APIKeyAuth определяет пользователя по ключу API, если он передан. Запросы без
+// ключа проходят дальше и авторизуются по куке; неверный или отозванный ключ
+// отклоняется, а не превращается молча в нового анонимного пользователя.
+func APIKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, exists := auth.APIKeyFromRequest(r)
+		if !exists {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := storage.OperationContext(r.Context())
+		apiKey, err := store.GetAPIKey(ctx, auth.HashAPIKey(key))
+		cancel()
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && apiKey.RevokedAt != nil) {
+			writeJSONError(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logger.Log.Error("Error getting api key: ", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), apiKey.UserID)))
+	})
+}
+
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > maxAPIKeyNameLength {
+		writeJSONError(w, "api key name is too long", http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		logger.Log.Error("Error generating api key: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, err := newAPIKeyID()
+	if err != nil {
+		logger.Log.Error("Error generating api key id: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	apiKey := models.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		Hash:      auth.HashAPIKey(key),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	if err := store.SaveAPIKey(ctx, apiKey); err != nil {
+		logger.Log.Error("Error saving api key: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Кука нужна, чтобы новый пользователь мог потом увидеть и отозвать свой ключ.
+	if err := setAuthCookie(w, r, userID); err != nil {
+		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	keys, err := store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		logger.Log.Error("Error listing api keys: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	// Чужие ключи не отличаются от несуществующих.
+	err = store.RevokeAPIKey(ctx, userID, chi.URLParam(r, "id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSONError(w, "api key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Error revoking api key: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAPIKeyID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/analytics"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+var clicks *analytics.Recorder
+
+func InitializeClickRecorder(r *analytics.Recorder) {
+	clicks = r
+}
+
+func recordClick(r *http.Request, shortURL string) {
+	if clicks == nil {
+		return
+	}
+	clicks.Record(models.ClickEvent{
+		ShortURL:  shortURL,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		ClientIP:  clientIP(r),
+	})
+}
+
+var trustedProxies []netip.Prefix
+
+// InitializeTrustedProxies задаёт адреса прокси, которым можно верить в заголовках
+// X-Forwarded-For и X-Real-IP. Без них заголовки игнорируются.
+func InitializeTrustedProxies(prefixes []netip.Prefix) {
+	trustedProxies = prefixes
+}
+
+// ParseTrustedProxies разбирает список адресов и подсетей через запятую.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP возвращает адрес клиента. Заголовки прокси учитываются, только если
+// запрос пришёл от доверенного прокси, иначе любой клиент подставил бы чужой адрес.
+// В X-Forwarded-For берётся самый правый адрес, не принадлежащий доверенным прокси:
+// левее него значения мог дописать сам клиент.
+func clientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if i == 0 || !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
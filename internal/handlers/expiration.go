@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxTTLSeconds — наибольший ttl_seconds, который ещё помещается в time.Duration (около 292 лет).
+const maxTTLSeconds = math.MaxInt64 / int64(time.Second)
+
+func resolveExpiration(expiresAt *time.Time, ttlSeconds int64, now time.Time) (*time.Time, error) {
+	if expiresAt != nil && ttlSeconds != 0 {
+		return nil, errors.New("only one of expires_at and ttl_seconds may be set")
+	}
+	if ttlSeconds < 0 {
+		return nil, errors.New("ttl_seconds must be positive")
+	}
+	if ttlSeconds > maxTTLSeconds {
+		return nil, fmt.Errorf("ttl_seconds must not exceed %d", maxTTLSeconds)
+	}
+	if ttlSeconds > 0 {
+		deadline := now.Add(time.Duration(ttlSeconds) * time.Second)
+		return &deadline, nil
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	return expiresAt, nil
+}
+
+func expirationFromQuery(query url.Values, now time.Time) (*time.Time, error) {
+	var (
+		expiresAt  *time.Time
+		ttlSeconds int64
+	)
+	if raw := query.Get("expires_at"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, errors.New("expires_at must be in RFC 3339 format")
+		}
+		expiresAt = &parsed
+	}
+	if raw := query.Get("ttl_seconds"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errors.New("ttl_seconds must be an integer")
+		}
+		ttlSeconds = parsed
+	}
+	return resolveExpiration(expiresAt, ttlSeconds, now)
+}
@@ -1,21 +1,22 @@
 package handlers
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/AvdeevK/url-cutter.git/internal/auth"
 	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/AvdeevK/url-cutter.git/internal/deletion"
 	"github.com/AvdeevK/url-cutter.git/internal/logger"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
 	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
 var (
@@ -28,27 +29,86 @@ func InitializeStorage(s storage.Storage) {
 	store = s
 }
 
-func generateShortURL(length int) (string, error) {
-	bytes := make([]byte, length)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(bytes)[:length], nil
+var deletions *deletion.Queue
+
+func InitializeDeletionQueue(q *deletion.Queue) {
+	deletions = q
 }
 
+// ValidateAndSetAuthCookie возвращает пользователя из ключа API или куки и продлевает
+// куку активному пользователю. Без действующей куки, в том числе после выхода,
+// пользователь получает новый идентификатор.
 func ValidateAndSetAuthCookie(w http.ResponseWriter, r *http.Request) (string, error) {
-	userID, exists, err := auth.GetAuthCookie(r)
-	if !exists || err != nil {
-		logger.Log.Warn(fmt.Sprintf("error getting auth cookie or: %v", err))
-		logger.Log.Info("start process of creating cookie")
-		newUserID, err := auth.GenerateUserID()
-		if err != nil {
-			logger.Log.Info("error of generating user id")
-			return "", errors.New("unable to generate user id")
+	// Пользователь уже определён по ключу API.
+	if userID, ok := auth.UserIDFromContext(r.Context()); ok {
+		return userID, nil
+	}
+	claims, err := currentSession(r)
+	if err != nil {
+		logger.Log.Error("failed to check auth session", zap.Error(err))
+		return "", errors.New("unable to check session")
+	}
+	if claims != nil {
+		if auth.NeedsRenewal(claims, time.Now()) {
+			if err := auth.RenewAuthCookie(w, claims); err != nil {
+				logger.Log.Warn("failed to renew auth cookie", zap.Error(err))
+			}
 		}
-		userID = newUserID
+		return claims.UserID, nil
+	}
+
+	logger.Log.Info("start process of creating cookie")
+	newUserID, err := auth.GenerateUserID()
+	if err != nil {
+		logger.Log.Info("error of generating user id")
+		return "", errors.New("unable to generate user id")
+	}
+	return newUserID, nil
+}
+
+// currentSession возвращает утверждения действующей куки или nil, если куки нет,
+// она недействительна или её сессия отозвана. Ошибка означает сбой хранилища.
+func currentSession(r *http.Request) (*auth.Claims, error) {
+	claims, err := auth.ParseAuthCookie(r)
+	if err != nil {
+		logger.Log.Warn(fmt.Sprintf("error getting auth cookie or: %v", err))
+		return nil, nil
+	}
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	revoked, err := store.IsSessionRevoked(ctx, claims.SessionID)
+	if err != nil || revoked {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// setAuthCookie выдаёт куку пользователю, у которого её ещё нет. Действующую куку
+// продлевает ValidateAndSetAuthCookie, а пользователю с ключом API кука не нужна.
+func setAuthCookie(w http.ResponseWriter, r *http.Request, userID string) error {
+	if current, ok := auth.UserIDFromContext(r.Context()); ok && current == userID {
+		return nil
+	}
+	// Отозванная сессия сюда не доходит: для неё ValidateAndSetAuthCookie выдал
+	// другой идентификатор.
+	if claims, err := auth.ParseAuthCookie(r); err == nil && claims.UserID == userID {
+		return nil
+	}
+	return auth.SetAuthCookie(w, userID)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{Error: message}); err != nil {
+		logger.Log.Info(fmt.Sprintf("error encoding response: %s", err))
 	}
-	return userID, nil
 }
 
 func NotAllowedMethodsHandler(w http.ResponseWriter, r *http.Request) {
@@ -79,27 +139,62 @@ func PostURLHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	url := string(body)
+	url, err := normalizeURL(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkDestination(r, userID, url); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
-	shortURL, err := generateShortURL(8)
+	shortURL, err := resolveShortURL(r.URL.Query().Get("alias"))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := expirationFromQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	existingShortURL, err := store.SaveURL(shortURL, url, userID)
+	redirectType, err := redirectTypeFromQuery(r.URL.Query())
 	if err != nil {
-		if err.Error() == "conflict" {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	shortURL, err = saveURL(ctx, models.AddNewURLRecord{
+		ShortURL:     shortURL,
+		OriginalURL:  url,
+		UserID:       userID,
+		ExpiresAt:    expiresAt,
+		RedirectType: redirectType,
+	})
+	if err != nil {
+		var conflictErr *storage.ConflictError
+		if errors.As(err, &conflictErr) {
 			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, existingShortURL)))
+			w.Write([]byte(fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, conflictErr.ShortURL)))
+			return
+		}
+		if errors.Is(err, storage.ErrShortURLTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
 		log.Printf("Error saving URL: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	scanThreat(ctx, r, userID, shortURL, url)
 
-	err = auth.SetAuthCookie(w, userID)
+	err = setAuthCookie(w, r, userID)
 	if err != nil {
 		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
 		return
@@ -139,17 +234,52 @@ func PostJSONHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shortURL, err := generateShortURL(8)
+	originalURL, err := normalizeURL(req.RequestURL)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkDestination(r, userID, originalURL); err != nil {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	existingShortURL, err := store.SaveURL(shortURL, req.RequestURL, userID)
+	shortURL, err := resolveShortURL(req.Alias)
 	if err != nil {
-		if err.Error() == "conflict" {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := resolveExpiration(req.ExpiresAt, req.TTLSeconds, time.Now())
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRedirectType(req.RedirectType); err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	shortURL, err = saveURL(ctx, models.AddNewURLRecord{
+		ShortURL:     shortURL,
+		OriginalURL:  originalURL,
+		UserID:       userID,
+		ExpiresAt:    expiresAt,
+		RedirectType: req.RedirectType,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrShortURLTaken) {
+			writeJSONError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		var conflictErr *storage.ConflictError
+		if errors.As(err, &conflictErr) {
 			resp := models.Response{
-				ResponseAddress: fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, existingShortURL),
+				ResponseAddress: fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, conflictErr.ShortURL),
 			}
 
 			w.Header().Set("Content-Type", "application/json")
@@ -166,12 +296,13 @@ func PostJSONHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	scanThreat(ctx, r, userID, shortURL, originalURL)
 
 	resp := models.Response{
 		ResponseAddress: fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, shortURL),
 	}
 
-	err = auth.SetAuthCookie(w, userID)
+	err = setAuthCookie(w, r, userID)
 	if err != nil {
 		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
 		return
@@ -213,33 +344,104 @@ func GetURLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	selectionResult := store.GetOriginalURL(shortURL)
-	if selectionResult.Error != nil {
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	selectionResult := store.GetOriginalURL(ctx, shortURL)
+	if errors.Is(selectionResult.Error, storage.ErrGone) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if errors.Is(selectionResult.Error, storage.ErrNotFound) {
 		logger.Log.Info(fmt.Sprintf("requested %s url, which isn't found", shortURL))
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if selectionResult.Error != nil {
+		logger.Log.Error("Error getting original URL: ", zap.Error(selectionResult.Error))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	if selectionResult.IsDeleted {
-		w.WriteHeader(http.StatusGone)
+	if reason, isBlocked := blockReason(selectionResult); isBlocked {
+		writeBlocked(w, r, shortURL, userID, selectionResult, reason)
+		return
+	}
+	if threatType := threatOf(ctx, r, userID, shortURL, selectionResult); threatType != "" {
+		writeThreatWarning(w, r, shortURL, selectionResult, threatType)
 		return
 	}
 
-	err = auth.SetAuthCookie(w, userID)
+	err = setAuthCookie(w, r, userID)
 	if err != nil {
 		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, selectionResult.OriginalURL, http.StatusTemporaryRedirect)
+	recordClick(r, shortURL)
+	redirect(w, r, selectionResult, time.Now())
 }
 
+func GetURLStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Получение userID и проверка на ошибку
+	logger.Log.Info("get auth cookie from request")
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	logger.Log.Info("finish getting auth cookie")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	shortURL := chi.URLParam(r, "short")
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	selectionResult := store.GetOriginalURL(ctx, shortURL)
+	if errors.Is(selectionResult.Error, storage.ErrNotFound) {
+		writeJSONError(w, "short url not found", http.StatusNotFound)
+		return
+	}
+	if selectionResult.Error != nil && !errors.Is(selectionResult.Error, storage.ErrGone) {
+		logger.Log.Error("Error getting original URL: ", zap.Error(selectionResult.Error))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if selectionResult.UserID != userID {
+		writeJSONError(w, "short url belongs to another user", http.StatusForbidden)
+		return
+	}
+
+	stats, err := store.GetURLStats(ctx, shortURL)
+	if err != nil {
+		logger.Log.Error("Error getting url stats: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+// PingDBHandler проверяет доступность хранилища, а не только базы данных:
+// хранилища в памяти и в файле всегда доступны, и для них /ping отвечает 200.
 func PingDBHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	err := DB.Ping()
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	err := store.Ping(ctx)
 	if err != nil {
 		logger.Log.Error("error of ping: ", zap.Error(err))
 		http.Error(w, "Database connection failed", http.StatusInternalServerError)
@@ -248,9 +450,10 @@ func PingDBHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// PostBatchURLHandler сохраняет корректные элементы пакета и возвращает статус по каждому:
+// 201, если все созданы, иначе 207 с причинами в ответах по отдельным элементам.
 func PostBatchURLHandler(w http.ResponseWriter, r *http.Request) {
 	var records []models.AddNewURLRecord
-	var responses []models.BatchResponse
 
 	//Получение userID и проверка на ошибку
 	logger.Log.Info("get auth cookie from request")
@@ -277,41 +480,88 @@ func PostBatchURLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for idx := 0; idx < len(records); idx++ {
-		if records[idx].OriginalURL == "" {
-			logger.Log.Warn("Original URL is empty for correlation ID")
-			w.WriteHeader(http.StatusBadRequest)
-			return
+	if config.Configs.BatchMaxSize > 0 && len(records) > config.Configs.BatchMaxSize {
+		writeJSONError(w, fmt.Sprintf("batch exceeds %d urls", config.Configs.BatchMaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := time.Now()
+	responses := make([]models.BatchResponse, len(records))
+	valid := make([]models.AddNewURLRecord, 0, len(records))
+	validIdx := make([]int, 0, len(records))
+	for idx := range records {
+		responses[idx].CorrelationID = records[idx].ID
+
+		records[idx].OriginalURL, err = normalizeURL(records[idx].OriginalURL)
+		if err != nil {
+			responses[idx].Status = models.BatchStatusInvalid
+			responses[idx].Error = err.Error()
+			continue
+		}
+		if err := checkDestination(r, userID, records[idx].OriginalURL); err != nil {
+			responses[idx].Status = models.BatchStatusBlocked
+			responses[idx].Error = err.Error()
+			continue
 		}
 
-		records[idx].ShortURL, err = generateShortURL(8)
+		records[idx].ExpiresAt, err = resolveExpiration(records[idx].ExpiresAt, records[idx].TTLSeconds, now)
 		if err != nil {
-			logger.Log.Error("Error creating short URL: ", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			responses[idx].Status = models.BatchStatusInvalid
+			responses[idx].Error = err.Error()
+			continue
+		}
+		records[idx].TTLSeconds = 0
+
+		if err := validateRedirectType(records[idx].RedirectType); err != nil {
+			responses[idx].Status = models.BatchStatusInvalid
+			responses[idx].Error = err.Error()
+			continue
 		}
 
 		records[idx].UserID = userID
+		valid = append(valid, records[idx])
+		validIdx = append(validIdx, idx)
+	}
+
+	if len(valid) > 0 {
+		ctx, cancel := storage.OperationContext(r.Context())
+		defer cancel()
 
-		responses = append(responses, models.BatchResponse{
-			CorrelationID: records[idx].ID,
-			ShortURL:      fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, records[idx].ShortURL),
-		})
+		results, err := saveBatch(ctx, valid)
+		if err != nil {
+			logger.Log.Error("Error saving URL in transaction: ", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Для уже сокращённых URL в ответ попадает существующий код.
+		for i, result := range results {
+			response := &responses[validIdx[i]]
+			response.ShortURL = fmt.Sprintf("%s/%s", config.Configs.ResponseAddress, result.ShortURL)
+			response.Status = models.BatchStatusCreated
+			if result.Existing {
+				response.Status = models.BatchStatusExisting
+				continue
+			}
+			scanThreat(ctx, r, userID, result.ShortURL, valid[i].OriginalURL)
+		}
 	}
 
-	if err := store.SaveBatch(records); err != nil {
-		logger.Log.Error("Error saving URL in transaction: ", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	status := http.StatusCreated
+	for _, response := range responses {
+		if response.Status != models.BatchStatusCreated {
+			status = http.StatusMultiStatus
+			break
+		}
 	}
 
-	err = auth.SetAuthCookie(w, userID)
+	err = setAuthCookie(w, r, userID)
 	if err != nil {
 		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(responses); err != nil {
 		logger.Log.Error("Error encoding response: ", zap.Error(err))
@@ -339,7 +589,10 @@ func GetAllUserURLsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "empty user id", http.StatusUnauthorized)
 	}
 
-	records, err := store.GetAllUserURLs(userID)
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	records, err := store.GetAllUserURLs(ctx, userID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -392,13 +645,100 @@ func DeleteUserURLsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go func(w http.ResponseWriter) {
-		if err := store.MarkURLsAsDeleted(userID, urlIDs); err != nil {
-			logger.Log.Error("Failed to mark URLs as deleted", zap.Error(err))
-			w.WriteHeader(http.StatusBadRequest)
+	if deletions == nil {
+		http.Error(w, "deletion queue is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	task, err := deletions.Enqueue(ctx, userID, urlIDs)
+	if err != nil {
+		if errors.Is(err, deletion.ErrQueueFull) || errors.Is(err, deletion.ErrQueueClosed) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
-	}(w)
+		logger.Log.Error("Failed to enqueue URLs deletion", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(models.DeletionJobResponse{JobID: task.ID}); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func RestoreUserURLsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Получение userID и проверка на ошибку
+	logger.Log.Info("get auth cookie from request")
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	logger.Log.Info("finish getting auth cookie")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var urlIDs []string
+	if err := json.NewDecoder(r.Body).Decode(&urlIDs); err != nil || len(urlIDs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	results, err := store.RestoreURLs(ctx, userID, urlIDs, time.Now().Add(-config.Configs.RestoreWindow))
+	if err != nil {
+		logger.Log.Error("Failed to restore URLs", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func GetDeletionJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Получение userID и проверка на ошибку
+	logger.Log.Info("get auth cookie from request")
+	userID, err := ValidateAndSetAuthCookie(w, r)
+	logger.Log.Info("finish getting auth cookie")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if deletions == nil {
+		http.Error(w, "deletion queue is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Чужие задачи не отличаются от несуществующих, чтобы не раскрывать их идентификаторы.
+	job, err := deletions.Job(userID, chi.URLParam(r, "id"))
+	if errors.Is(err, deletion.ErrJobNotFound) {
+		writeJSONError(w, "deletion job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"go.uber.org/zap"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var blockedPage = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Link unavailable</title></head>
+<body>
+<h1>This link is unavailable</h1>
+<p>The short link {{.ShortURL}} has been blocked.</p>
+{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+</body>
+</html>
+`))
+
+type interstitialData struct {
+	ShortURL string
+	URL      string
+	Reason   string
+}
+
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// writeInterstitial показывает браузеру страницу-предупреждение, остальным клиентам — JSON с ошибкой.
+func writeInterstitial(w http.ResponseWriter, r *http.Request, page *template.Template, status int, data interstitialData) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !acceptsHTML(r) {
+		writeJSONError(w, data.Reason, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Execute(w, data); err != nil {
+		logger.Log.Error("Error rendering interstitial: ", zap.Error(err))
+	}
+}
+
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Warning: unsafe link</title></head>
+<body>
+<h1>Warning: this link may be unsafe</h1>
+<p>The short link {{.ShortURL}} leads to a site reported as {{.Reason}}.
+Visiting it may harm your computer or steal your personal information.</p>
+<p>Continue at your own risk: <a href="{{.URL}}" rel="noopener noreferrer nofollow">{{.URL}}</a></p>
+</body>
+</html>
+`))
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+var oidcProvider *auth.OIDCProvider
+
+// InitializeOIDC включает вход через провайдера OpenID Connect.
+func InitializeOIDC(p *auth.OIDCProvider) {
+	oidcProvider = p
+}
+
+// OIDCLoginHandler отправляет пользователя на страницу входа провайдера.
+// С claim=true ссылки текущего анонимного пользователя переносятся в аккаунт.
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		writeJSONError(w, "oidc sign in is not configured", http.StatusNotFound)
+		return
+	}
+
+	flow, err := auth.NewOIDCFlow()
+	if err != nil {
+		logger.Log.Error("Error starting oidc flow: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	flow.Claim, _ = strconv.ParseBool(r.URL.Query().Get("claim"))
+	if err := auth.SetOIDCFlowCookie(w, flow); err != nil {
+		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, oidcProvider.AuthCodeURL(flow), http.StatusFound)
+}
+
+// OIDCCallbackHandler принимает код от провайдера, проверяет ID-токен и начинает
+// сессию пользователя, идентификатор которого выводится из issuer и subject.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		writeJSONError(w, "oidc sign in is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	flow, err := auth.ParseOIDCFlowCookie(r, query.Get("state"))
+	if err != nil {
+		logger.Log.Warn("invalid oidc callback", zap.Error(err))
+		writeJSONError(w, "invalid oidc state", http.StatusBadRequest)
+		return
+	}
+	auth.ClearOIDCFlowCookie(w)
+
+	if providerError := query.Get("error"); providerError != "" {
+		writeJSONError(w, "oidc sign in failed: "+providerError, http.StatusUnauthorized)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		writeJSONError(w, "missing authorization code", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := oidcProvider.Exchange(r.Context(), code, flow)
+	if err != nil {
+		logger.Log.Error("Error exchanging oidc code: ", zap.Error(err))
+		writeJSONError(w, "oidc sign in failed", http.StatusUnauthorized)
+		return
+	}
+	userID := auth.OIDCUserID(claims.Issuer, claims.Subject)
+
+	var claimed int64
+	if flow.Claim {
+		ctx, cancel := storage.OperationContext(r.Context())
+		defer cancel()
+
+		if claimed, err = claimAnonymousURLs(ctx, r, userID); err != nil {
+			logger.Log.Error("Error claiming anonymous urls: ", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := auth.SetAuthCookie(w, userID); err != nil {
+		http.Error(w, "unable to set cookie", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := models.OIDCLoginResponse{
+		UserID:  userID,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Claimed: claimed,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
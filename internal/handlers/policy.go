@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/policy"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const defaultBlockReason = "blocked by administrator"
+
+var destinations = policy.New()
+
+var audit, _ = policy.NewAudit(100, "")
+
+func InitializePolicy(p *policy.Policy, a *policy.Audit) {
+	destinations = p
+	audit = a
+}
+
+func auditEvent(r *http.Request, action, shortURL, url, userID, reason string) {
+	audit.Record(models.AuditEvent{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		ShortURL: shortURL,
+		URL:      url,
+		UserID:   userID,
+		RemoteIP: clientIP(r),
+		Reason:   reason,
+	})
+}
+
+// checkDestination сверяет домен с политикой и записывает отказ в аудит.
+func checkDestination(r *http.Request, userID, originalURL string) error {
+	err := destinations.CheckURL(originalURL)
+	if err != nil {
+		auditEvent(r, models.AuditActionShortenDenied, "", originalURL, userID, err.Error())
+	}
+	return err
+}
+
+// blockReason возвращает причину, по которой переход по ссылке запрещён: блокировку
+// администратором или домен, запрещённый политикой уже после сокращения.
+func blockReason(url models.OriginalURLSelectionResult) (string, bool) {
+	if url.BlockedAt != nil {
+		if url.BlockReason == "" {
+			return defaultBlockReason, true
+		}
+		return url.BlockReason, true
+	}
+	if err := destinations.CheckURL(url.OriginalURL); err != nil {
+		return err.Error(), true
+	}
+	return "", false
+}
+
+func writeBlocked(w http.ResponseWriter, r *http.Request, shortURL, userID string, url models.OriginalURLSelectionResult, reason string) {
+	auditEvent(r, models.AuditActionRedirectDenied, shortURL, url.OriginalURL, userID, reason)
+	writeInterstitial(w, r, blockedPage, http.StatusUnavailableForLegalReasons, interstitialData{
+		ShortURL: shortURL,
+		Reason:   reason,
+	})
+}
+
+func BlockURLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req models.BlockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = defaultBlockReason
+	}
+
+	shortURL := chi.URLParam(r, "short")
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	if !setBlock(w, store.BlockURL(ctx, shortURL, req.Reason)) {
+		return
+	}
+	auditEvent(r, models.AuditActionURLBlocked, shortURL, "", "", req.Reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func UnblockURLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	shortURL := chi.URLParam(r, "short")
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	if !setBlock(w, store.UnblockURL(ctx, shortURL)) {
+		return
+	}
+	auditEvent(r, models.AuditActionURLUnblocked, shortURL, "", "", "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setBlock(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, storage.ErrNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	default:
+		logger.Log.Error("Failed to change url block", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	return false
+}
+
+func GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(audit.Recent()); err != nil {
+		logger.Log.Error("Error encoding response: ", zap.Error(err))
+	}
+}
+
+func ReloadPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if err := destinations.Reload(); err != nil {
+		writeJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ValidateRedirectCode проверяет, что код подходит для ответа на переход по ссылке.
+func ValidateRedirectCode(code int) error {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("redirect type must be one of 301, 302, 307, 308, got %d", code)
+}
+
+// validateRedirectType допускает 0 — тогда используется код из конфигурации.
+func validateRedirectType(redirectType int) error {
+	if redirectType == 0 {
+		return nil
+	}
+	return ValidateRedirectCode(redirectType)
+}
+
+func redirectTypeFromQuery(query url.Values) (int, error) {
+	raw := query.Get("redirect_type")
+	if raw == "" {
+		return 0, nil
+	}
+	redirectType, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.New("redirect_type must be an integer")
+	}
+	return redirectType, validateRedirectType(redirectType)
+}
+
+func isPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
+
+// redirect отвечает кодом ссылки или кодом по умолчанию. Постоянные перенаправления
+// браузер кэширует, поэтому max-age не выходит за срок жизни ссылки; временные
+// не кэшируются совсем, чтобы удаление и статистика переходов работали.
+// Ответ с новой кукой кэширует только браузер: общий кэш отдал бы её всем.
+func redirect(w http.ResponseWriter, r *http.Request, url models.OriginalURLSelectionResult, now time.Time) {
+	code := url.RedirectType
+	if code == 0 {
+		code = config.Configs.RedirectCode
+	}
+	if code == 0 {
+		code = http.StatusTemporaryRedirect
+	}
+
+	cacheControl := "private, no-store"
+	if isPermanentRedirect(code) {
+		maxAge := config.Configs.PermanentRedirectTTL
+		if url.ExpiresAt != nil && url.ExpiresAt.Sub(now) < maxAge {
+			maxAge = url.ExpiresAt.Sub(now)
+		}
+		scope := "public"
+		if len(w.Header().Values("Set-Cookie")) > 0 {
+			scope = "private"
+		}
+		cacheControl = fmt.Sprintf("%s, max-age=%d", scope, int64(maxAge/time.Second))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	http.Redirect(w, r, url.OriginalURL, code)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/auth"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// LogoutHandler отзывает сессию из куки и удаляет куку. Отзыв действует и на
+// токены той же сессии, выданные раньше при продлении. Повторный выход и выход
+// без куки ничего не меняют.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := auth.ParseAuthCookie(r)
+	if err == nil && claims.SessionID != "" {
+		// Новых токенов в отозванной сессии не будет, поэтому запись нужна не дольше
+		// срока жизни токена, выданного последним.
+		expiresAt := time.Now().Add(auth.SessionLifetime())
+		if claims.ExpiresAt != nil && claims.ExpiresAt.After(expiresAt) {
+			expiresAt = claims.ExpiresAt.Time
+		}
+
+		ctx, cancel := storage.OperationContext(r.Context())
+		defer cancel()
+
+		if err := store.RevokeSession(ctx, claims.SessionID, expiresAt); err != nil {
+			logger.Log.Error("Error revoking session: ", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	auth.ClearAuthCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/shortcode"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+)
+
+// maxCodeAttempts — сколько раз подряд сгенерированный код может оказаться занятым.
+const maxCodeAttempts = 5
+
+var errCodeAttemptsExhausted = errors.New("failed to generate a free short url")
+
+var codes shortcode.Generator = shortcode.NewRandomGenerator(shortcode.Base62, 8)
+
+func InitializeCodeGenerator(g shortcode.Generator) {
+	codes = g
+}
+
+// saveURL сохраняет ссылку и возвращает её код. Если псевдоним не задан, код
+// генерируется заново, пока хранилище отвечает, что он уже занят.
+func saveURL(ctx context.Context, record models.AddNewURLRecord) (string, error) {
+	if record.ShortURL != "" {
+		return record.ShortURL, store.SaveURL(ctx, record)
+	}
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		generated, err := codes.Generate(ctx, 1)
+		if err != nil {
+			return "", err
+		}
+		record.ShortURL = generated[0]
+		err = store.SaveURL(ctx, record)
+		if !errors.Is(err, storage.ErrShortURLTaken) {
+			return record.ShortURL, err
+		}
+	}
+	return "", errCodeAttemptsExhausted
+}
+
+// saveBatch назначает записям новые коды и повторяет сохранение пакета целиком,
+// если хотя бы один из кодов уже занят. Все хранилища сохраняют пакет атомарно,
+// поэтому от неудачной попытки не остаётся записей с прежними кодами.
+func saveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		generated, err := codes.Generate(ctx, len(records))
+		if err != nil {
+			return nil, err
+		}
+		for i := range records {
+			records[i].ShortURL = generated[i]
+		}
+		results, err := store.SaveBatch(ctx, records)
+		if !errors.Is(err, storage.ErrShortURLTaken) {
+			return results, err
+		}
+	}
+	return nil, errCodeAttemptsExhausted
+}
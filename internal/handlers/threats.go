@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/storage"
+	"github.com/AvdeevK/url-cutter.git/internal/threats"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+var scanner = threats.New()
+
+func InitializeThreatScanner(s *threats.Scanner) {
+	scanner = s
+}
+
+// scanThreat проверяет адрес назначения по списку угроз и помечает ссылку в хранилище
+// только при совпадении полного хэша. Совпадение одного префикса попадает в журнал
+// как неподтверждённое и ссылку не трогает: без полного хэша это часто ложная тревога.
+func scanThreat(ctx context.Context, r *http.Request, userID, shortURL, originalURL string) string {
+	match, found := scanner.Check(originalURL)
+	if !found {
+		return ""
+	}
+	if !match.Confirmed {
+		auditEvent(r, models.AuditActionThreatUnverified, shortURL, originalURL, userID, match.ThreatType)
+		return ""
+	}
+	auditEvent(r, models.AuditActionThreatFlagged, shortURL, originalURL, userID, match.ThreatType)
+	if err := store.FlagURL(ctx, shortURL, match.ThreatType); err != nil {
+		logger.Log.Error("Failed to flag url", zap.String("short_url", shortURL), zap.Error(err))
+	}
+	return match.ThreatType
+}
+
+// threatOf возвращает тип угрозы ссылки. Ссылка, адрес которой попал в список
+// уже после сокращения, помечается при первом переходе.
+func threatOf(ctx context.Context, r *http.Request, userID, shortURL string, url models.OriginalURLSelectionResult) string {
+	if url.ThreatType != "" {
+		return url.ThreatType
+	}
+	return scanThreat(ctx, r, userID, shortURL, url.OriginalURL)
+}
+
+func writeThreatWarning(w http.ResponseWriter, r *http.Request, shortURL string, url models.OriginalURLSelectionResult, threatType string) {
+	writeInterstitial(w, r, warningPage, http.StatusForbidden, interstitialData{
+		ShortURL: shortURL,
+		URL:      url.OriginalURL,
+		Reason:   threatType,
+	})
+}
+
+// UnflagURLHandler снимает пометку об угрозе. Пока адрес остаётся в списке угроз,
+// ссылка снова будет помечена при следующем переходе.
+func UnflagURLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	shortURL := chi.URLParam(r, "short")
+	ctx, cancel := storage.OperationContext(r.Context())
+	defer cancel()
+
+	if !setBlock(w, store.FlagURL(ctx, shortURL, "")) {
+		return
+	}
+	auditEvent(r, models.AuditActionThreatUnflagged, shortURL, "", "", "")
+	w.WriteHeader(http.StatusNoContent)
+}
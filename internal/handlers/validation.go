@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/AvdeevK/url-cutter.git/internal/urlnorm"
+	"strings"
+)
+
+// normalizeURL проверяет URL по настройкам сервиса и возвращает его канонический вид,
+// по которому хранилище находит повторы.
+func normalizeURL(raw string) (string, error) {
+	var schemes []string
+	for _, scheme := range strings.Split(config.Configs.AllowedSchemes, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return urlnorm.Normalize(raw, urlnorm.Options{
+		AllowedSchemes: schemes,
+		StripTracking:  config.Configs.StripTrackingParams,
+		MaxLength:      config.Configs.MaxURLLength,
+	})
+}
@@ -1,19 +1,34 @@
 package models
 
+import "time"
+
 type Request struct {
-	RequestURL string `json:"url"`
+	RequestURL   string     `json:"url"`
+	Alias        string     `json:"alias,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds   int64      `json:"ttl_seconds,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
 }
 
 type Response struct {
 	ResponseAddress string `json:"result"`
 }
 
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
 type AddNewURLRecord struct {
-	ID          string `json:"correlation_id"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UserID      string `json:"user_id"`
-	DeletedFlag bool   `json:"is_deleted"`
+	ID          string     `json:"correlation_id"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	UserID      string     `json:"user_id"`
+	DeletedFlag bool       `json:"is_deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds  int64      `json:"ttl_seconds,omitempty"`
+	// RedirectType — код ответа при переходе по ссылке, 0 означает код по умолчанию.
+	RedirectType int `json:"redirect_type,omitempty"`
 }
 
 type BatchRequest struct {
@@ -21,9 +36,25 @@ type BatchRequest struct {
 	OriginalURL   string `json:"original_url"`
 }
 
+const (
+	BatchStatusCreated  = "created"
+	BatchStatusExisting = "existing"
+	BatchStatusInvalid  = "invalid"
+	BatchStatusBlocked  = "blocked"
+)
+
 type BatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BatchSaveResult — итог сохранения одной записи пакета: Existing означает,
+// что исходный URL уже был сокращён и ShortURL содержит существующий код.
+type BatchSaveResult struct {
+	ShortURL string
+	Existing bool
 }
 
 type BasePairsOfURLsResponse struct {
@@ -31,11 +62,184 @@ type BasePairsOfURLsResponse struct {
 	OriginalURL string `json:"original_url"`
 }
 
-var PairsOfURLs = make(map[string]OriginalURLSelectionResult)
-
 type OriginalURLSelectionResult struct {
-	OriginalURL string
-	IsDeleted   bool
-	Error       error
-	UserID      string
+	OriginalURL  string
+	IsDeleted    bool
+	Error        error
+	UserID       string
+	ExpiresAt    *time.Time
+	DeletedAt    *time.Time
+	RedirectType int
+	// BlockedAt заполнен, если администратор заблокировал ссылку.
+	BlockedAt   *time.Time
+	BlockReason string
+	// ThreatType заполнен, если адрес назначения нашёлся в списке угроз.
+	ThreatType string
+}
+
+type ClickEvent struct {
+	ShortURL  string    `json:"short_url"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+type URLStats struct {
+	ShortURL    string        `json:"short_url"`
+	TotalClicks int64         `json:"total_clicks"`
+	LastClickAt *time.Time    `json:"last_click_at,omitempty"`
+	Days        []DailyClicks `json:"days"`
+}
+
+type URLToDelete struct {
+	UserID   string `json:"user_id"`
+	ShortURL string `json:"short_url"`
+}
+
+type DeletionTask struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ShortURLs []string  `json:"short_urls"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	DeletionStatusDeleted  = "deleted"
+	DeletionStatusNotFound = "not_found"
+	DeletionStatusNotOwned = "not_owned"
+)
+
+const (
+	RestoreStatusRestored      = "restored"
+	RestoreStatusNotDeleted    = "not_deleted"
+	RestoreStatusExpired       = "expired"
+	RestoreStatusWindowExpired = "restore_window_expired"
+)
+
+type DeletionResult struct {
+	UserID   string
+	ShortURL string
+	Status   string
+}
+
+const (
+	JobStateQueued  = "queued"
+	JobStateRunning = "running"
+	JobStateDone    = "done"
+	JobStateFailed  = "failed"
+)
+
+type DeletionJob struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	State      string     `json:"state"`
+	Requested  int        `json:"requested"`
+	Deleted    int        `json:"deleted"`
+	NotFound   int        `json:"not_found"`
+	NotOwned   int        `json:"not_owned"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type DeletionJobResponse struct {
+	JobID string `json:"job_id"`
+}
+
+type RestoreResult struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+}
+
+type PurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+const (
+	AuditActionShortenDenied   = "shorten_denied"
+	AuditActionRedirectDenied  = "redirect_denied"
+	AuditActionURLBlocked      = "url_blocked"
+	AuditActionURLUnblocked    = "url_unblocked"
+	AuditActionThreatFlagged   = "threat_flagged"
+	AuditActionThreatUnflagged = "threat_unflagged"
+	// AuditActionThreatUnverified — совпал только префикс хэша, ссылка не помечена.
+	AuditActionThreatUnverified = "threat_unverified"
+)
+
+// AuditEvent — запись журнала заблокированных попыток и действий администратора.
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	ShortURL string    `json:"short_url,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	UserID   string    `json:"user_id,omitempty"`
+	RemoteIP string    `json:"remote_ip,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+type BlockRequest struct {
+	Reason string `json:"reason"`
+}
+
+// APIKey — долгоживущий ключ доступа к API. Сам ключ не хранится, только его хэш.
+type APIKey struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"-"`
+	Name      string     `json:"name,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateAPIKeyResponse — единственный ответ, в котором ключ возвращается целиком.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// User — зарегистрированный пользователь. ID совпадает с идентификатором в куке,
+// поэтому ссылки аккаунта находятся так же, как ссылки анонимного пользователя.
+type User struct {
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CredentialsRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// Claim переносит в аккаунт ссылки текущего анонимного пользователя.
+	// При регистрации ссылки переносятся всегда.
+	Claim bool `json:"claim,omitempty"`
+}
+
+type AccountResponse struct {
+	User
+	Claimed int64 `json:"claimed"`
+}
+
+// OIDCLoginResponse — результат входа через провайдера OpenID Connect.
+type OIDCLoginResponse struct {
+	UserID  string `json:"id"`
+	Subject string `json:"subject"`
+	Email   string `json:"email,omitempty"`
+	Claimed int64  `json:"claimed"`
 }
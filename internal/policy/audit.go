@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"encoding/json"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+)
+
+// Audit хранит последние события в памяти и, если задан путь, дописывает
+// все события в файл по одному JSON в строке.
+type Audit struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+	next   int
+	full   bool
+	file   *os.File
+}
+
+func NewAudit(size int, path string) (*Audit, error) {
+	a := &Audit{events: make([]models.AuditEvent, max(size, 1))}
+	if path == "" {
+		return a, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a.file = file
+	return a, nil
+}
+
+func (a *Audit) Record(event models.AuditEvent) {
+	logger.Log.Warn("policy audit event",
+		zap.String("action", event.Action),
+		zap.String("short_url", event.ShortURL),
+		zap.String("url", event.URL),
+		zap.String("user_id", event.UserID),
+		zap.String("remote_ip", event.RemoteIP),
+		zap.String("reason", event.Reason),
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events[a.next] = event
+	a.next = (a.next + 1) % len(a.events)
+	if a.next == 0 {
+		a.full = true
+	}
+
+	if a.file == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		logger.Log.Error("failed to encode audit event", zap.Error(err))
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		logger.Log.Error("failed to write audit event", zap.Error(err))
+	}
+}
+
+// Recent возвращает сохранённые в памяти события, начиная с самых новых.
+func (a *Audit) Recent() []models.AuditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	count := a.next
+	if a.full {
+		count = len(a.events)
+	}
+	events := make([]models.AuditEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		events = append(events, a.events[(a.next-i+len(a.events))%len(a.events)])
+	}
+	return events
+}
+
+func (a *Audit) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,186 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrDomainNotAllowed = errors.New("destination domain is not allowed")
+
+// Rules — списки доменов. Шаблон "*.example.com" совпадает с любым поддоменом
+// example.com, но не с ним самим; остальные шаблоны с '*' сравниваются через
+// path.Match, а шаблоны без '*' — целиком.
+type Rules struct {
+	allow []string
+	deny  []string
+}
+
+// ParseRules читает правила по одному в строке: "allow <шаблон>" или "deny <шаблон>".
+// Пустые строки и строки, начинающиеся с '#', пропускаются.
+func ParseRules(r io.Reader) (*Rules, error) {
+	rules := &Rules{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"allow <domain>\" or \"deny <domain>\"", lineNumber)
+		}
+		pattern := strings.ToLower(strings.TrimSuffix(fields[1], "."))
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		switch fields[0] {
+		case "allow":
+			rules.allow = append(rules.allow, pattern)
+		case "deny":
+			rules.deny = append(rules.deny, pattern)
+		default:
+			return nil, fmt.Errorf("line %d: unknown rule %q", lineNumber, fields[0])
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// CheckHost запрещает домены из deny-списка, а при непустом allow-списке — и все,
+// что в него не входят.
+func (r *Rules) CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range r.deny {
+		if matchDomain(pattern, host) {
+			return fmt.Errorf("%w: %s is denied", ErrDomainNotAllowed, host)
+		}
+	}
+	if len(r.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range r.allow {
+		if matchDomain(pattern, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in the allow list", ErrDomainNotAllowed, host)
+}
+
+func matchDomain(pattern, host string) bool {
+	if suffix, isWildcard := strings.CutPrefix(pattern, "*."); isWildcard && !strings.Contains(suffix, "*") {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	if strings.Contains(pattern, "*") {
+		matched, _ := path.Match(pattern, host)
+		return matched
+	}
+	return pattern == host
+}
+
+// Policy хранит текущие правила и подменяет их целиком при перечитывании файла,
+// поэтому проверки не блокируются перезагрузкой.
+type Policy struct {
+	rules atomic.Pointer[Rules]
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+}
+
+// New возвращает политику без ограничений.
+func New() *Policy {
+	p := &Policy{}
+	p.rules.Store(&Rules{})
+	return p
+}
+
+func Load(path string) (*Policy, error) {
+	p := New()
+	p.path = path
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload перечитывает файл правил. При ошибке остаются прежние правила.
+func (p *Policy) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.path == "" {
+		return nil
+	}
+	file, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// Время запоминается и для ошибочного файла, чтобы Watch не повторял ту же ошибку.
+	p.modTime = info.ModTime()
+	rules, err := ParseRules(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	p.rules.Store(rules)
+	return nil
+}
+
+// Watch перечитывает файл правил, когда меняется время его модификации,
+// пока не будет отменён ctx.
+func (p *Policy) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !p.changed() {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				logger.Log.Error("failed to reload domain policy", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("domain policy reloaded", zap.String("path", p.path))
+		}
+	}
+}
+
+func (p *Policy) changed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.path == "" {
+		return false
+	}
+	info, err := os.Stat(p.path)
+	return err == nil && !info.ModTime().Equal(p.modTime)
+}
+
+// CheckURL проверяет домен уже нормализованного URL.
+func (p *Policy) CheckURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return p.rules.Load().CheckHost(parsed.Hostname())
+}
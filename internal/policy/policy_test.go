@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesCheckHost(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# фишинг
+deny evil.com
+deny *.phish.net
+deny bad-*.org
+`))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, rules.CheckHost("evil.com"), ErrDomainNotAllowed)
+	assert.ErrorIs(t, rules.CheckHost("EVIL.com."), ErrDomainNotAllowed)
+	assert.ErrorIs(t, rules.CheckHost("login.bank.phish.net"), ErrDomainNotAllowed)
+	assert.ErrorIs(t, rules.CheckHost("bad-site.org"), ErrDomainNotAllowed)
+	assert.NoError(t, rules.CheckHost("phish.net"))
+	assert.NoError(t, rules.CheckHost("www.evil.com"))
+	assert.NoError(t, rules.CheckHost("example.com"))
+}
+
+func TestRulesAllowList(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("allow example.com\nallow *.example.com\ndeny private.example.com\n"))
+	require.NoError(t, err)
+
+	assert.NoError(t, rules.CheckHost("example.com"))
+	assert.NoError(t, rules.CheckHost("docs.example.com"))
+	assert.ErrorIs(t, rules.CheckHost("private.example.com"), ErrDomainNotAllowed)
+	assert.ErrorIs(t, rules.CheckHost("other.com"), ErrDomainNotAllowed)
+}
+
+func TestParseRulesRejectsMalformedLines(t *testing.T) {
+	for _, input := range []string{"block evil.com", "deny", "deny a b", "deny [evil.com"} {
+		_, err := ParseRules(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(path, []byte("deny evil.com\n"), 0o644))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+	assert.Error(t, p.CheckURL("https://evil.com/login"))
+	assert.NoError(t, p.CheckURL("https://good.com/"))
+	assert.False(t, p.changed())
+
+	require.NoError(t, os.WriteFile(path, []byte("deny good.com\n"), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	assert.True(t, p.changed())
+	require.NoError(t, p.Reload())
+	assert.NoError(t, p.CheckURL("https://evil.com/login"))
+	assert.Error(t, p.CheckURL("https://good.com/"))
+
+	// Ошибочный файл не заменяет действующие правила.
+	require.NoError(t, os.WriteFile(path, []byte("forbid good.com\n"), 0o644))
+	assert.Error(t, p.Reload())
+	assert.Error(t, p.CheckURL("https://good.com/"))
+}
+
+func TestAuditKeepsRecentEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAudit(2, path)
+	require.NoError(t, err)
+
+	for _, shortURL := range []string{"first", "second", "third"} {
+		a.Record(models.AuditEvent{Action: models.AuditActionRedirectDenied, ShortURL: shortURL})
+	}
+	require.NoError(t, a.Close())
+
+	recent := a.Recent()
+	require.Len(t, recent, 2)
+	assert.Equal(t, "third", recent[0].ShortURL)
+	assert.Equal(t, "second", recent[1].ShortURL)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+}
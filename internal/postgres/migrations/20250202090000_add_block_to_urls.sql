@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS block_reason TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN IF EXISTS block_reason;
+ALTER TABLE urls DROP COLUMN IF EXISTS blocked_at;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ссылки, удалённые до появления deleted_at, получают окно восстановления с момента обновления.
+UPDATE urls SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+)
+
+// maxFilterRounds ограничивает число догенераций, если фильтр отбрасывает почти всё.
+const maxFilterRounds = 10
+
+var ErrAllCodesBlocked = errors.New("generator keeps producing blocked codes")
+
+// Filter отбрасывает коды, которые нельзя выдавать пользователям.
+type Filter interface {
+	Blocked(code string) bool
+}
+
+type filteredGenerator struct {
+	Generator
+	filter Filter
+}
+
+// WithFilter заменяет отброшенные фильтром коды новыми.
+func WithFilter(g Generator, filter Filter) Generator {
+	return &filteredGenerator{Generator: g, filter: filter}
+}
+
+func (g *filteredGenerator) Generate(ctx context.Context, n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for round := 0; round < maxFilterRounds && len(codes) < n; round++ {
+		generated, err := g.Generator.Generate(ctx, n-len(codes))
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range generated {
+			if !g.filter.Blocked(code) {
+				codes = append(codes, code)
+			}
+		}
+	}
+	if len(codes) < n {
+		return nil, ErrAllCodesBlocked
+	}
+	return codes, nil
+}
@@ -0,0 +1,31 @@
+package shortcode
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type prefixFilter string
+
+func (f prefixFilter) Blocked(code string) bool {
+	return strings.HasPrefix(code, string(f))
+}
+
+func TestWithFilterSkipsBlockedCodes(t *testing.T) {
+	sequential, err := NewSequentialGenerator(&testCounter{}, "0123456789", 2, "")
+	require.NoError(t, err)
+
+	// Коды 01–09 начинаются с нуля и отбрасываются.
+	codes, err := WithFilter(sequential, prefixFilter("0")).Generate(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10", "11"}, codes)
+}
+
+func TestWithFilterGivesUp(t *testing.T) {
+	_, err := WithFilter(NewRandomGenerator("ab", 4), prefixFilter("")).Generate(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrAllCodesBlocked)
+}
@@ -0,0 +1,109 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const feistelRounds = 4
+
+// SequentialGenerator кодирует значения счётчика в выбранном алфавите. Если задан
+// ключ, значения внутри каждого блока из len(alphabet)^length кодов переставляются
+// сетью Фейстеля, и по одному коду нельзя угадать соседние.
+type SequentialGenerator struct {
+	counter  Counter
+	alphabet string
+	length   int
+	space    int64
+	key      []byte
+}
+
+func NewSequentialGenerator(counter Counter, alphabet string, length int, obfuscationKey string) (*SequentialGenerator, error) {
+	if counter == nil {
+		return nil, errors.New("sequential codes require a counter")
+	}
+	space := int64(1)
+	for i := 0; i < length; i++ {
+		if space > math.MaxInt64/int64(len(alphabet)) {
+			return nil, fmt.Errorf("code length %d is too large for sequential codes", length)
+		}
+		space *= int64(len(alphabet))
+	}
+	g := &SequentialGenerator{
+		counter:  counter,
+		alphabet: alphabet,
+		length:   length,
+		space:    space,
+	}
+	if obfuscationKey != "" {
+		g.key = []byte(obfuscationKey)
+	}
+	return g, nil
+}
+
+func (g *SequentialGenerator) Generate(ctx context.Context, n int) ([]string, error) {
+	ids, err := g.counter.ReserveCodeIDs(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if g.key != nil {
+			id = id/g.space*g.space + g.permute(id%g.space)
+		}
+		codes = append(codes, encode(id, g.alphabet, g.length))
+	}
+	return codes, nil
+}
+
+// permute — биекция на [0, space): сеть Фейстеля работает на ближайшем сверху
+// чётном числе бит, а значения вне диапазона прогоняются через неё повторно.
+func (g *SequentialGenerator) permute(x int64) int64 {
+	half := (bits.Len64(uint64(g.space-1)) + 1) / 2
+	mask := uint64(1)<<half - 1
+	value := uint64(x)
+	for {
+		left, right := value>>half, value&mask
+		for round := 0; round < feistelRounds; round++ {
+			left, right = right, left^(g.roundFunction(round, right)&mask)
+		}
+		value = left<<half | right
+		if value < uint64(g.space) {
+			return int64(value)
+		}
+	}
+}
+
+func (g *SequentialGenerator) roundFunction(round int, value uint64) uint64 {
+	var input [9]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint64(input[1:], value)
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// encode записывает n в системе счисления с основанием len(alphabet), дополняя
+// результат слева нулевым символом до minLength.
+func encode(n int64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+	value := uint64(n)
+	var digits []byte
+	for value > 0 {
+		digits = append(digits, alphabet[value%base])
+		value /= base
+	}
+	for len(digits) < minLength {
+		digits = append(digits, alphabet[0])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
@@ -0,0 +1,101 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Base62 — алфавит по умолчанию: только цифры и латинские буквы.
+const Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+)
+
+var ErrInvalidAlphabet = errors.New("alphabet must contain at least two distinct characters from [A-Za-z0-9_-]")
+
+// Generator выдаёт n новых коротких кодов. Уникальность кодов относительно уже
+// сохранённых ссылок гарантирует хранилище, генератор лишь делает коллизии редкими.
+type Generator interface {
+	Generate(ctx context.Context, n int) ([]string, error)
+}
+
+// Counter выдаёт n ещё не использованных значений монотонного счётчика.
+type Counter interface {
+	ReserveCodeIDs(ctx context.Context, n int) ([]int64, error)
+}
+
+// Options описывает формат кодов. Для последовательной стратегии Length — минимальная
+// длина: когда коды этой длины заканчиваются, они становятся длиннее.
+type Options struct {
+	Strategy       string
+	Alphabet       string
+	Length         int
+	ObfuscationKey string
+}
+
+func New(opts Options, counter Counter) (Generator, error) {
+	if err := validateAlphabet(opts.Alphabet); err != nil {
+		return nil, err
+	}
+	if opts.Length < 1 {
+		return nil, fmt.Errorf("code length must be positive, got %d", opts.Length)
+	}
+	switch opts.Strategy {
+	case StrategyRandom:
+		return NewRandomGenerator(opts.Alphabet, opts.Length), nil
+	case StrategySequential:
+		return NewSequentialGenerator(counter, opts.Alphabet, opts.Length, opts.ObfuscationKey)
+	}
+	return nil, fmt.Errorf("unknown code strategy %q", opts.Strategy)
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return ErrInvalidAlphabet
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		isAllowed := c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '-' || c == '_'
+		if !isAllowed || strings.IndexByte(alphabet[i+1:], c) >= 0 {
+			return ErrInvalidAlphabet
+		}
+	}
+	return nil
+}
+
+// RandomGenerator выбирает символы равновероятно из криптографического источника.
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+func NewRandomGenerator(alphabet string, length int) *RandomGenerator {
+	return &RandomGenerator{alphabet: alphabet, length: length}
+}
+
+func (g *RandomGenerator) Generate(ctx context.Context, n int) ([]string, error) {
+	// Байты не меньше limit отбрасываются, иначе первые символы алфавита выпадали бы чаще.
+	limit := 256 - 256%len(g.alphabet)
+	codes := make([]string, 0, n)
+	buf := make([]byte, g.length*2)
+	for len(codes) < n {
+		code := make([]byte, 0, g.length)
+		for len(code) < g.length {
+			if _, err := rand.Read(buf); err != nil {
+				return nil, err
+			}
+			for _, b := range buf {
+				if int(b) < limit && len(code) < g.length {
+					code = append(code, g.alphabet[int(b)%len(g.alphabet)])
+				}
+			}
+		}
+		codes = append(codes, string(code))
+	}
+	return codes, nil
+}
@@ -0,0 +1,101 @@
+package shortcode
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCounter struct {
+	last atomic.Int64
+}
+
+func (c *testCounter) ReserveCodeIDs(ctx context.Context, n int) ([]int64, error) {
+	last := c.last.Add(int64(n))
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = last - int64(n) + int64(i) + 1
+	}
+	return ids, nil
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts Options
+	}{
+		{name: "short alphabet", opts: Options{Strategy: StrategyRandom, Alphabet: "a", Length: 8}},
+		{name: "duplicate characters", opts: Options{Strategy: StrategyRandom, Alphabet: "abca", Length: 8}},
+		{name: "unsafe characters", opts: Options{Strategy: StrategyRandom, Alphabet: "ab/", Length: 8}},
+		{name: "zero length", opts: Options{Strategy: StrategyRandom, Alphabet: Base62, Length: 0}},
+		{name: "unknown strategy", opts: Options{Strategy: "hash", Alphabet: Base62, Length: 8}},
+		{name: "overflowing length", opts: Options{Strategy: StrategySequential, Alphabet: Base62, Length: 20}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.opts, &testCounter{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g := NewRandomGenerator("abc", 12)
+	codes, err := g.Generate(context.Background(), 50)
+	require.NoError(t, err)
+	require.Len(t, codes, 50)
+	for _, code := range codes {
+		assert.Len(t, code, 12)
+		assert.Empty(t, strings.Trim(code, "abc"))
+	}
+}
+
+func TestSequentialGenerator(t *testing.T) {
+	g, err := NewSequentialGenerator(&testCounter{}, Base62, 4, "")
+	require.NoError(t, err)
+
+	codes, err := g.Generate(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0001", "0002", "0003"}, codes)
+
+	// Когда коды минимальной длины заканчиваются, выдаются более длинные.
+	counter := &testCounter{}
+	counter.last.Store(62*62 - 1)
+	g, err = NewSequentialGenerator(counter, Base62, 2, "")
+	require.NoError(t, err)
+	codes, err = g.Generate(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"100", "101"}, codes)
+}
+
+func TestSequentialGeneratorObfuscation(t *testing.T) {
+	const alphabet = "0123456789"
+	g, err := NewSequentialGenerator(&testCounter{}, alphabet, 3, "secret")
+	require.NoError(t, err)
+
+	// Перестановка взаимно однозначна: счётчик начинается с 1, и все 999 кодов
+	// первого блока различны.
+	codes, err := g.Generate(context.Background(), 999)
+	require.NoError(t, err)
+	seen := make(map[string]struct{}, len(codes))
+	ordered := 0
+	for i, code := range codes {
+		assert.Len(t, code, 3)
+		seen[code] = struct{}{}
+		if code == encode(int64(i+1), alphabet, 3) {
+			ordered++
+		}
+	}
+	assert.Len(t, seen, 999)
+	assert.Less(t, ordered, 10)
+
+	other, err := NewSequentialGenerator(&testCounter{}, alphabet, 3, "another secret")
+	require.NoError(t, err)
+	otherCodes, err := other.Generate(context.Background(), 10)
+	require.NoError(t, err)
+	assert.NotEqual(t, codes[:10], otherCodes)
+}
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS deletion_tasks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    short_urls TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+    );
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS deletion_tasks;
+-- +goose StatementEnd
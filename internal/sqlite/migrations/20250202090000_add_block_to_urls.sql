@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN blocked_at INTEGER;
+ALTER TABLE urls ADD COLUMN block_reason TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN block_reason;
+ALTER TABLE urls DROP COLUMN blocked_at;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Удалённые ссылки без deleted_at получают окно восстановления с момента обновления.
+UPDATE urls SET deleted_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000 WHERE is_deleted = 1 AND deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"database/sql"
+	"github.com/pressly/goose/v3"
+	"log"
+	// Драйвер на чистом Go, сборка не требует cgo.
+	_ "modernc.org/sqlite"
+)
+
+// Open открывает файл базы с WAL-журналом. SQLite допускает одного писателя,
+// поэтому пул ограничен одним соединением, а конкурентные запросы ждут в нём, а не в busy_timeout.
+func Open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func RunMigrations(db *sql.DB, migrationsDir string) error {
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		return err
+	}
+	if err := goose.Up(db, migrationsDir); err != nil {
+		return err
+	}
+	log.Println("Migrations applied successfully")
+	return nil
+}
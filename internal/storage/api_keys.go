@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// apiKeys хранит ключи API для хранилищ без БД.
+type apiKeys struct {
+	mu     sync.RWMutex
+	byID   map[string]*models.APIKey
+	byHash map[string]*models.APIKey
+}
+
+func newAPIKeys() *apiKeys {
+	return &apiKeys{
+		byID:   make(map[string]*models.APIKey),
+		byHash: make(map[string]*models.APIKey),
+	}
+}
+
+func (k *apiKeys) add(key models.APIKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.byID[key.ID] = &key
+	k.byHash[key.Hash] = &key
+}
+
+func (k *apiKeys) get(hash string) (models.APIKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, exists := k.byHash[hash]
+	if !exists {
+		return models.APIKey{}, false
+	}
+	return *key, true
+}
+
+func (k *apiKeys) userKeys(userID string) []models.APIKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	result := make([]models.APIKey, 0)
+	for _, key := range k.byID {
+		if key.UserID == userID {
+			result = append(result, *key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// revoke отзывает ключ пользователя; повторный отзыв не меняет время отзыва.
+func (k *apiKeys) revoke(userID, id string, now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, exists := k.byID[id]
+	if !exists || key.UserID != userID {
+		return false
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &now
+	}
+	return true
+}
+
+func (k *apiKeys) list() []models.APIKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	result := make([]models.APIKey, 0, len(k.byID))
+	for _, key := range k.byID {
+		result = append(result, *key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// fileAPIKey — запись ключа в файле: в отличие от ответа API, в ней сохраняются
+// владелец и хэш.
+type fileAPIKey struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"key_hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
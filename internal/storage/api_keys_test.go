@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			key := models.APIKey{
+				ID:        "key-1",
+				UserID:    "alice",
+				Name:      "ci",
+				Prefix:    "uc_abcdef",
+				Hash:      "hash-1",
+				CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+			}
+			require.NoError(t, store.SaveAPIKey(ctx, key))
+
+			found, err := store.GetAPIKey(ctx, "hash-1")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", found.UserID)
+			assert.Nil(t, found.RevokedAt)
+			_, err = store.GetAPIKey(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			keys, err := store.ListAPIKeys(ctx, "alice")
+			require.NoError(t, err)
+			assert.Len(t, keys, 1)
+			keys, err = store.ListAPIKeys(ctx, "bob")
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+
+			assert.ErrorIs(t, store.RevokeAPIKey(ctx, "bob", "key-1"), ErrNotFound)
+			require.NoError(t, store.RevokeAPIKey(ctx, "alice", "key-1"))
+			found, err = store.GetAPIKey(ctx, "hash-1")
+			require.NoError(t, err)
+			require.NotNil(t, found.RevokedAt)
+
+			// Повторный отзыв не меняет время отзыва.
+			revokedAt := *found.RevokedAt
+			require.NoError(t, store.RevokeAPIKey(ctx, "alice", "key-1"))
+			found, err = store.GetAPIKey(ctx, "hash-1")
+			require.NoError(t, err)
+			assert.True(t, revokedAt.Equal(*found.RevokedAt))
+		})
+	}
+}
+
+func TestFileStoragePersistsAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	for _, id := range []string{"active", "revoked"} {
+		require.NoError(t, fs.SaveAPIKey(ctx, models.APIKey{
+			ID:        id,
+			UserID:    "alice",
+			Prefix:    "uc_" + id,
+			Hash:      "hash-" + id,
+			CreatedAt: time.Now().UTC(),
+		}))
+	}
+	require.NoError(t, fs.RevokeAPIKey(ctx, "alice", "revoked"))
+	require.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	active, err := reloaded.GetAPIKey(ctx, "hash-active")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", active.UserID)
+	assert.Nil(t, active.RevokedAt)
+	revoked, err := reloaded.GetAPIKey(ctx, "hash-revoked")
+	require.NoError(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveBatchReturnsExistingCodes(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			assert.NoError(t, s.SaveURL(ctx, models.AddNewURLRecord{
+				ShortURL: "old", OriginalURL: "https://example.com/old", UserID: "alice",
+			}))
+
+			results, err := s.SaveBatch(ctx, []models.AddNewURLRecord{
+				{ShortURL: "new", OriginalURL: "https://example.com/new", UserID: "bob"},
+				{ShortURL: "again", OriginalURL: "https://example.com/old", UserID: "bob"},
+				// Повтор внутри пакета получает код первого вхождения.
+				{ShortURL: "dup", OriginalURL: "https://example.com/new", UserID: "bob"},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []models.BatchSaveResult{
+				{ShortURL: "new"},
+				{ShortURL: "old", Existing: true},
+				{ShortURL: "new", Existing: true},
+			}, results)
+
+			assert.ErrorIs(t, s.GetOriginalURL(ctx, "again").Error, ErrNotFound)
+			assert.ErrorIs(t, s.GetOriginalURL(ctx, "dup").Error, ErrNotFound)
+			// Существующая ссылка остаётся за прежним владельцем.
+			assert.Equal(t, "alice", s.GetOriginalURL(ctx, "old").UserID)
+			urls, err := s.GetAllUserURLs(ctx, "bob")
+			assert.NoError(t, err)
+			assert.Len(t, urls, 1)
+		})
+	}
+}
+
+func TestSaveBatchRespectsCanceledContext(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := s.SaveBatch(ctx, []models.AddNewURLRecord{
+				{ShortURL: "first", OriginalURL: "https://example.com/first", UserID: "alice"},
+			})
+			assert.Error(t, err)
+			assert.ErrorIs(t, s.GetOriginalURL(context.Background(), "first").Error, ErrNotFound)
+		})
+	}
+}
+
+func TestSaveBatchIsAllOrNothing(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			assert.NoError(t, s.SaveURL(ctx, models.AddNewURLRecord{
+				ShortURL: "taken", OriginalURL: "https://example.com/taken", UserID: "alice",
+			}))
+
+			_, err := s.SaveBatch(ctx, []models.AddNewURLRecord{
+				{ShortURL: "first", OriginalURL: "https://example.com/first", UserID: "alice"},
+				{ShortURL: "taken", OriginalURL: "https://example.com/second", UserID: "alice"},
+			})
+			assert.ErrorIs(t, err, ErrShortURLTaken)
+			assert.ErrorIs(t, s.GetOriginalURL(ctx, "first").Error, ErrNotFound)
+
+			// Повтор с новыми кодами создаёт записи заново, а не находит старые.
+			results, err := s.SaveBatch(ctx, []models.AddNewURLRecord{
+				{ShortURL: "retry-1", OriginalURL: "https://example.com/first", UserID: "alice"},
+				{ShortURL: "retry-2", OriginalURL: "https://example.com/second", UserID: "alice"},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []models.BatchSaveResult{{ShortURL: "retry-1"}, {ShortURL: "retry-2"}}, results)
+		})
+	}
+}
+
+func TestFileStorageFailedBatchLeavesNoLogEntries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	assert.NoError(t, err)
+	assert.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL: "taken", OriginalURL: "https://example.com/taken", UserID: "alice",
+	}))
+	_, err = fs.SaveBatch(ctx, []models.AddNewURLRecord{
+		{ShortURL: "first", OriginalURL: "https://example.com/first", UserID: "alice"},
+		{ShortURL: "taken", OriginalURL: "https://example.com/second", UserID: "alice"},
+	})
+	assert.ErrorIs(t, err, ErrShortURLTaken)
+	assert.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	assert.NoError(t, err)
+	defer reloaded.Close()
+	assert.ErrorIs(t, reloaded.GetOriginalURL(ctx, "first").Error, ErrNotFound)
+	assert.NoError(t, reloaded.GetOriginalURL(ctx, "taken").Error)
+}
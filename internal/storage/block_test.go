@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageBlocksURLs(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.SaveURL(ctx, models.AddNewURLRecord{
+				ShortURL:    "phishing",
+				OriginalURL: "https://example.com/login",
+				UserID:      "alice",
+			}))
+
+			require.NoError(t, store.BlockURL(ctx, "phishing", "phishing"))
+			url := store.GetOriginalURL(ctx, "phishing")
+			require.NoError(t, url.Error)
+			assert.NotNil(t, url.BlockedAt)
+			assert.Equal(t, "phishing", url.BlockReason)
+
+			require.NoError(t, store.UnblockURL(ctx, "phishing"))
+			url = store.GetOriginalURL(ctx, "phishing")
+			assert.Nil(t, url.BlockedAt)
+			assert.Empty(t, url.BlockReason)
+
+			assert.ErrorIs(t, store.BlockURL(ctx, "missing", "phishing"), ErrNotFound)
+			assert.ErrorIs(t, store.UnblockURL(ctx, "missing"), ErrNotFound)
+		})
+	}
+}
+
+func TestFileStoragePersistsBlocksAndFlags(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	for _, shortURL := range []string{"blocked", "unblocked"} {
+		require.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{
+			ShortURL:    shortURL,
+			OriginalURL: "https://example.com/" + shortURL,
+			UserID:      "alice",
+		}))
+		require.NoError(t, fs.BlockURL(ctx, shortURL, "spam"))
+	}
+	require.NoError(t, fs.UnblockURL(ctx, "unblocked"))
+	require.NoError(t, fs.FlagURL(ctx, "unblocked", "MALWARE"))
+	require.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	assert.Equal(t, "spam", reloaded.GetOriginalURL(ctx, "blocked").BlockReason)
+	assert.Nil(t, reloaded.GetOriginalURL(ctx, "unblocked").BlockedAt)
+
+	// Блокировка переживает компактизацию журнала.
+	require.NoError(t, reloaded.Compact())
+	require.NoError(t, reloaded.Close())
+	compacted, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer compacted.Close()
+	assert.NotNil(t, compacted.GetOriginalURL(ctx, "blocked").BlockedAt)
+	assert.Nil(t, compacted.GetOriginalURL(ctx, "unblocked").BlockedAt)
+	assert.Equal(t, "MALWARE", compacted.GetOriginalURL(ctx, "unblocked").ThreatType)
+}
+
+func TestStorageFlagsURLs(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.SaveURL(ctx, models.AddNewURLRecord{
+				ShortURL:    "download",
+				OriginalURL: "https://example.com/setup.exe",
+				UserID:      "alice",
+			}))
+
+			require.NoError(t, store.FlagURL(ctx, "download", "MALWARE"))
+			assert.Equal(t, "MALWARE", store.GetOriginalURL(ctx, "download").ThreatType)
+
+			require.NoError(t, store.FlagURL(ctx, "download", ""))
+			assert.Empty(t, store.GetOriginalURL(ctx, "download").ThreatType)
+
+			assert.ErrorIs(t, store.FlagURL(ctx, "missing", "MALWARE"), ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry struct {
+	shortURL  string
+	url       models.OriginalURLSelectionResult
+	expiresAt time.Time
+}
+
+// lruCache — ограниченный по размеру кэш с вытеснением давно не читанных записей.
+// version растёт при каждой инвалидации, чтобы результат запроса, начатого до неё,
+// не попал в кэш.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	items   map[string]*list.Element
+	order   *list.List
+	version uint64
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *lruCache) get(shortURL string, now time.Time) (models.OriginalURLSelectionResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.items[shortURL]
+	if !exists {
+		return models.OriginalURLSelectionResult{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.items, shortURL)
+		return models.OriginalURLSelectionResult{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.url, true
+}
+
+func (c *lruCache) currentVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version
+}
+
+func (c *lruCache) set(shortURL string, url models.OriginalURLSelectionResult, expiresAt time.Time, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+	if element, exists := c.items[shortURL]; exists {
+		element.Value = &cacheEntry{shortURL: shortURL, url: url, expiresAt: expiresAt}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[shortURL] = c.order.PushFront(&cacheEntry{shortURL: shortURL, url: url, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).shortURL)
+	}
+}
+
+func (c *lruCache) remove(shortURLs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	for _, shortURL := range shortURLs {
+		if element, exists := c.items[shortURL]; exists {
+			c.order.Remove(element)
+			delete(c.items, shortURL)
+		}
+	}
+}
+
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// CachedStorage кэширует GetOriginalURL любого хранилища. Остальные методы
+// проксируются как есть, а меняющие ссылки сбрасывают затронутые записи кэша.
+type CachedStorage struct {
+	Storage
+
+	cache       *lruCache
+	group       singleflight.Group
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewCachedStorage(backend Storage, size int, ttl, negativeTTL time.Duration) *CachedStorage {
+	return &CachedStorage{
+		Storage:     backend,
+		cache:       newLRUCache(size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+func (c *CachedStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
+	now := time.Now()
+	if url, exists := c.cache.get(shortURL, now); exists {
+		c.hits.Add(1)
+		// Ссылка могла истечь уже после того, как попала в кэш.
+		if url.Error == nil {
+			url = withSelectionState(url, now)
+		}
+		return url
+	}
+	c.misses.Add(1)
+
+	// Одновременные промахи по одному коду сводятся к одному запросу в хранилище.
+	// Запрос не зависит от отмены контекста первого вызывающего, иначе она
+	// оборвала бы запрос и для остальных.
+	value, _, _ := c.group.Do(shortURL, func() (interface{}, error) {
+		version := c.cache.currentVersion()
+		opCtx, cancel := OperationContext(context.WithoutCancel(ctx))
+		defer cancel()
+
+		url := c.Storage.GetOriginalURL(opCtx, shortURL)
+		switch {
+		case url.Error == nil || errors.Is(url.Error, ErrGone):
+			c.cache.set(shortURL, url, time.Now().Add(c.ttl), version)
+		case errors.Is(url.Error, ErrNotFound) && c.negativeTTL > 0:
+			c.cache.set(shortURL, url, time.Now().Add(c.negativeTTL), version)
+		}
+		return url, nil
+	})
+	return value.(models.OriginalURLSelectionResult)
+}
+
+func (c *CachedStorage) invalidate(shortURLs ...string) {
+	c.cache.remove(shortURLs)
+	for _, shortURL := range shortURLs {
+		c.group.Forget(shortURL)
+	}
+}
+
+func (c *CachedStorage) SaveURL(ctx context.Context, record models.AddNewURLRecord) error {
+	err := c.Storage.SaveURL(ctx, record)
+	// Сбрасывается отрицательная запись, если код только что заняли.
+	c.invalidate(record.ShortURL)
+	return err
+}
+
+func (c *CachedStorage) SaveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	results, err := c.Storage.SaveBatch(ctx, records)
+	shortURLs := make([]string, 0, len(records))
+	for _, record := range records {
+		shortURLs = append(shortURLs, record.ShortURL)
+	}
+	c.invalidate(shortURLs...)
+	return results, err
+}
+
+func (c *CachedStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	results, err := c.Storage.MarkURLsAsDeleted(ctx, urls)
+	shortURLs := make([]string, 0, len(urls))
+	for _, url := range urls {
+		shortURLs = append(shortURLs, url.ShortURL)
+	}
+	c.invalidate(shortURLs...)
+	return results, err
+}
+
+func (c *CachedStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error) {
+	results, err := c.Storage.RestoreURLs(ctx, userID, shortURLs, deletedAfter)
+	c.invalidate(shortURLs...)
+	return results, err
+}
+
+func (c *CachedStorage) BlockURL(ctx context.Context, shortURL, reason string) error {
+	err := c.Storage.BlockURL(ctx, shortURL, reason)
+	c.invalidate(shortURL)
+	return err
+}
+
+func (c *CachedStorage) UnblockURL(ctx context.Context, shortURL string) error {
+	err := c.Storage.UnblockURL(ctx, shortURL)
+	c.invalidate(shortURL)
+	return err
+}
+
+func (c *CachedStorage) FlagURL(ctx context.Context, shortURL, threatType string) error {
+	err := c.Storage.FlagURL(ctx, shortURL, threatType)
+	c.invalidate(shortURL)
+	return err
+}
+
+// ReassignURLs сбрасывает кэш целиком: коды перенесённых ссылок заранее неизвестны.
+func (c *CachedStorage) ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	moved, err := c.Storage.ReassignURLs(ctx, fromUserID, toUserID)
+	if moved > 0 {
+		c.cache.clear()
+	}
+	return moved, err
+}
+
+func (c *CachedStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	purged, err := c.Storage.PurgeDeletedURLs(ctx, deletedBefore)
+	if purged > 0 {
+		c.cache.clear()
+	}
+	return purged, err
+}
+
+func (c *CachedStorage) CacheStats() models.CacheStats {
+	return models.CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.cache.len(),
+	}
+}
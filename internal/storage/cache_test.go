@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type slowStorage struct {
+	*MemoryStorage
+	lookups atomic.Int64
+	delay   time.Duration
+}
+
+func (s *slowStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
+	s.lookups.Add(1)
+	time.Sleep(s.delay)
+	return s.MemoryStorage.GetOriginalURL(ctx, shortURL)
+}
+
+func TestCachedStorageCollapsesMisses(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowStorage{MemoryStorage: NewMemoryStorage(), delay: 50 * time.Millisecond}
+	assert.NoError(t, backend.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL:    "hot",
+		OriginalURL: "https://example.com/hot",
+		UserID:      "alice",
+	}))
+	cached := NewCachedStorage(backend, 10, time.Minute, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "https://example.com/hot", cached.GetOriginalURL(ctx, "hot").OriginalURL)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), backend.lookups.Load())
+
+	cached.GetOriginalURL(ctx, "hot")
+	stats := cached.CacheStats()
+	assert.Equal(t, int64(1), backend.lookups.Load())
+	assert.Equal(t, int64(21), stats.Hits+stats.Misses)
+	assert.GreaterOrEqual(t, stats.Hits, int64(1))
+}
+
+func TestCachedStorageInvalidation(t *testing.T) {
+	ctx := context.Background()
+	backend := &slowStorage{MemoryStorage: NewMemoryStorage()}
+	cached := NewCachedStorage(backend, 10, time.Minute, time.Minute)
+
+	// Отрицательный результат кэшируется, но сбрасывается при сохранении кода.
+	assert.ErrorIs(t, cached.GetOriginalURL(ctx, "new").Error, ErrNotFound)
+	assert.ErrorIs(t, cached.GetOriginalURL(ctx, "new").Error, ErrNotFound)
+	assert.Equal(t, int64(1), backend.lookups.Load())
+
+	assert.NoError(t, cached.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL:    "new",
+		OriginalURL: "https://example.com/new",
+		UserID:      "alice",
+	}))
+	assert.NoError(t, cached.GetOriginalURL(ctx, "new").Error)
+
+	_, err := cached.MarkURLsAsDeleted(ctx, []models.URLToDelete{{UserID: "alice", ShortURL: "new"}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, cached.GetOriginalURL(ctx, "new").Error, ErrGone)
+	assert.Equal(t, int64(3), backend.lookups.Load())
+}
+
+func TestLRUCacheEvictsOldest(t *testing.T) {
+	cache := newLRUCache(2)
+	now := time.Now()
+	expiresAt := now.Add(time.Minute)
+
+	cache.set("a", models.OriginalURLSelectionResult{OriginalURL: "a"}, expiresAt, 0)
+	cache.set("b", models.OriginalURLSelectionResult{OriginalURL: "b"}, expiresAt, 0)
+	_, _ = cache.get("a", now)
+	cache.set("c", models.OriginalURLSelectionResult{OriginalURL: "c"}, expiresAt, 0)
+
+	_, exists := cache.get("b", now)
+	assert.False(t, exists)
+	_, exists = cache.get("a", now)
+	assert.True(t, exists)
+	_, exists = cache.get("c", expiresAt)
+	assert.False(t, exists)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"sort"
+	"time"
+)
+
+const clickDayLayout = "2006-01-02"
+
+type clickStats struct {
+	total     int64
+	lastClick time.Time
+	days      map[string]int64
+}
+
+// clickAggregates хранит агрегаты переходов для хранилищ без собственной БД.
+type clickAggregates map[string]*clickStats
+
+func (c clickAggregates) add(event models.ClickEvent) {
+	stats, exists := c[event.ShortURL]
+	if !exists {
+		stats = &clickStats{days: make(map[string]int64)}
+		c[event.ShortURL] = stats
+	}
+	stats.total++
+	stats.days[event.ClickedAt.UTC().Format(clickDayLayout)]++
+	if event.ClickedAt.After(stats.lastClick) {
+		stats.lastClick = event.ClickedAt
+	}
+}
+
+func (c clickAggregates) get(shortURL string) models.URLStats {
+	result := models.URLStats{
+		ShortURL: shortURL,
+		Days:     make([]models.DailyClicks, 0),
+	}
+	stats, exists := c[shortURL]
+	if !exists {
+		return result
+	}
+
+	result.TotalClicks = stats.total
+	lastClick := stats.lastClick
+	result.LastClickAt = &lastClick
+	for day, clicks := range stats.days {
+		result.Days = append(result.Days, models.DailyClicks{Date: day, Clicks: clicks})
+	}
+	sort.Slice(result.Days, func(i, j int) bool {
+		return result.Days[i].Date < result.Days[j].Date
+	})
+	return result
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// codeIDBlock — сколько значений счётчика файловое хранилище резервирует за одну запись
+// на диск. После перезапуска недовыданный остаток блока пропускается.
+const codeIDBlock = 1000
+
+func codeIDRange(first int64, n int) []int64 {
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = first + int64(i)
+	}
+	return ids
+}
+
+// fileCodeCounter хранит в файле верхнюю границу уже зарезервированных значений.
+type fileCodeCounter struct {
+	mu    sync.Mutex
+	path  string
+	next  int64
+	limit int64
+}
+
+func loadFileCodeCounter(path string) (*fileCodeCounter, error) {
+	c := &fileCodeCounter{path: path, next: 1, limit: 1}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	limit, err := strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	c.next, c.limit = limit, limit
+	return c, nil
+}
+
+func (c *fileCodeCounter) reserve(n int) ([]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next+int64(n) > c.limit {
+		limit := c.next + int64(n) + codeIDBlock
+		err := rewriteFile(c.path, func(w *bufio.Writer) error {
+			_, err := w.WriteString(strconv.FormatInt(limit, 10) + "\n")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.limit = limit
+	}
+	ids := codeIDRange(c.next, n)
+	c.next += int64(n)
+	return ids, nil
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/AvdeevK/url-cutter.git/internal/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	stressWorkers = 16
+	stressURLs    = 200
+)
+
+func newTestStorages(t *testing.T) map[string]Storage {
+	fs, err := NewFileStorage(filepath.Join(t.TempDir(), "urls.json"), SyncNever)
+	if err != nil {
+		t.Fatalf("failed to create file storage: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "urls.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := sqlite.RunMigrations(db, filepath.Join("..", "sqlite", "migrations")); err != nil {
+		t.Fatalf("failed to migrate sqlite database: %v", err)
+	}
+
+	return map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"file":   fs,
+		"sqlite": NewSQLiteStorage(db),
+	}
+}
+
+func TestStorageConcurrentAccess(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			var wg sync.WaitGroup
+
+			for w := 0; w < stressWorkers; w++ {
+				wg.Add(3)
+				go func(worker int) {
+					defer wg.Done()
+					for i := 0; i < stressURLs; i++ {
+						err := s.SaveURL(ctx, models.AddNewURLRecord{
+							ShortURL:    fmt.Sprintf("w%d-%d", worker, i),
+							OriginalURL: fmt.Sprintf("https://example.com/%d/%d", worker, i),
+							UserID:      fmt.Sprintf("user-%d", worker),
+						})
+						assert.NoError(t, err)
+					}
+				}(w)
+				go func(worker int) {
+					defer wg.Done()
+					for i := 0; i < stressURLs; i++ {
+						s.GetOriginalURL(ctx, fmt.Sprintf("w%d-%d", (worker+1)%stressWorkers, i))
+						_, err := s.GetAllUserURLs(ctx, fmt.Sprintf("user-%d", worker))
+						assert.NoError(t, err)
+					}
+				}(w)
+				go func(worker int) {
+					defer wg.Done()
+					for i := 0; i < stressURLs; i++ {
+						item := models.URLToDelete{
+							UserID:   fmt.Sprintf("user-%d", worker),
+							ShortURL: fmt.Sprintf("w%d-%d", worker, i),
+						}
+						_, err := s.MarkURLsAsDeleted(ctx, []models.URLToDelete{item})
+						assert.NoError(t, err)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			for w := 0; w < stressWorkers; w++ {
+				for i := 0; i < stressURLs; i++ {
+					result := s.GetOriginalURL(ctx, fmt.Sprintf("w%d-%d", w, i))
+					assert.NotErrorIs(t, result.Error, ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestStorageConcurrentAliasUniqueness(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			var (
+				wg      sync.WaitGroup
+				created atomic.Int64
+				taken   atomic.Int64
+			)
+
+			for w := 0; w < stressWorkers; w++ {
+				wg.Add(1)
+				go func(worker int) {
+					defer wg.Done()
+					err := s.SaveURL(ctx, models.AddNewURLRecord{
+						ShortURL:    "q4-report",
+						OriginalURL: fmt.Sprintf("https://example.com/report/%d", worker),
+						UserID:      fmt.Sprintf("user-%d", worker),
+					})
+					switch {
+					case err == nil:
+						created.Add(1)
+					case errors.Is(err, ErrShortURLTaken):
+						taken.Add(1)
+					default:
+						t.Errorf("unexpected error: %v", err)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			assert.Equal(t, int64(1), created.Load())
+			assert.Equal(t, int64(stressWorkers-1), taken.Load())
+		})
+	}
+}
+
+func TestStorageKeepsRedirectType(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.SaveURL(ctx, models.AddNewURLRecord{
+				ShortURL:     "permanent",
+				OriginalURL:  "https://example.com/permanent",
+				UserID:       "alice",
+				RedirectType: 308,
+			})
+			assert.NoError(t, err)
+			_, err = store.SaveBatch(ctx, []models.AddNewURLRecord{
+				{ShortURL: "default", OriginalURL: "https://example.com/default", UserID: "alice"},
+				{ShortURL: "found", OriginalURL: "https://example.com/found", UserID: "alice", RedirectType: 302},
+			})
+			assert.NoError(t, err)
+
+			assert.Equal(t, 308, store.GetOriginalURL(ctx, "permanent").RedirectType)
+			assert.Equal(t, 0, store.GetOriginalURL(ctx, "default").RedirectType)
+			assert.Equal(t, 302, store.GetOriginalURL(ctx, "found").RedirectType)
+		})
+	}
+}
+
+func TestStorageConcurrentCodeIDs(t *testing.T) {
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				seen = make(map[int64]struct{})
+				wg   sync.WaitGroup
+			)
+			for worker := 0; worker < stressWorkers; worker++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 10; i++ {
+						ids, err := store.ReserveCodeIDs(context.Background(), 3)
+						assert.NoError(t, err)
+						mu.Lock()
+						for _, id := range ids {
+							seen[id] = struct{}{}
+						}
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Len(t, seen, stressWorkers*10*3)
+		})
+	}
+}
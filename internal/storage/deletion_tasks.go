@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"sort"
+	"sync"
+)
+
+// deletionTasks хранит незавершённые задачи удаления для хранилищ без БД.
+type deletionTasks struct {
+	mu    sync.Mutex
+	tasks map[string]models.DeletionTask
+}
+
+func newDeletionTasks() *deletionTasks {
+	return &deletionTasks{tasks: make(map[string]models.DeletionTask)}
+}
+
+func (d *deletionTasks) add(task models.DeletionTask) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.tasks[task.ID] = task
+}
+
+func (d *deletionTasks) remove(ids []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, id := range ids {
+		delete(d.tasks, id)
+	}
+}
+
+func (d *deletionTasks) list() []models.DeletionTask {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]models.DeletionTask, 0, len(d.tasks))
+	for _, task := range d.tasks {
+		result = append(result, task)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
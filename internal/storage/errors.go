@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("short url not found")
+	ErrGone          = errors.New("short url is gone")
+	ErrConflict      = errors.New("original url already shortened")
+	ErrShortURLTaken = errors.New("short url is already taken")
+	ErrLoginTaken    = errors.New("login is already taken")
+)
+
+// ConflictError возвращается при попытке сократить уже сохранённый URL
+// и содержит его существующий короткий код.
+type ConflictError struct {
+	ShortURL string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConflict, e.ShortURL)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// batchSaveResult превращает конфликт по исходному URL в результат с существующим кодом.
+func batchSaveResult(record models.AddNewURLRecord, err error) (models.BatchSaveResult, error) {
+	var conflict *ConflictError
+	switch {
+	case err == nil:
+		return models.BatchSaveResult{ShortURL: record.ShortURL}, nil
+	case errors.As(err, &conflict):
+		return models.BatchSaveResult{ShortURL: conflict.ShortURL, Existing: true}, nil
+	default:
+		return models.BatchSaveResult{}, err
+	}
+}
+
+func withSelectionState(result models.OriginalURLSelectionResult, now time.Time) models.OriginalURLSelectionResult {
+	if result.IsDeleted || (result.ExpiresAt != nil && !now.Before(*result.ExpiresAt)) {
+		result.Error = ErrGone
+	}
+	return result
+}
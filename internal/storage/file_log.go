@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"time"
+)
+
+// SyncPolicy определяет, когда записи журнала FileStorage сбрасываются на диск.
+type SyncPolicy string
+
+const (
+	// SyncAlways — fsync после каждой записи.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval — fsync в фоне раз в интервал, при падении теряются последние записи.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever — сброс на диск остаётся на усмотрение ОС.
+	SyncNever SyncPolicy = "never"
+)
+
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(value); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown file sync policy %q", value)
+	}
+}
+
+const (
+	fileOpDelete  = "delete"
+	fileOpRestore = "restore"
+	fileOpBlock   = "block"
+	fileOpUnblock = "unblock"
+	fileOpFlag    = "flag"
+	fileOpOwner   = "owner"
+)
+
+// fileLogEntry — строка журнала ссылок. Записи без op сохраняют ссылку целиком
+// и совпадают с форматом старых файлов, остальные меняют состояние уже сохранённой.
+type fileLogEntry struct {
+	models.AddNewURLRecord
+	Op          string     `json:"op,omitempty"`
+	BlockedAt   *time.Time `json:"blocked_at,omitempty"`
+	BlockReason string     `json:"block_reason,omitempty"`
+	ThreatType  string     `json:"threat_type,omitempty"`
+}
@@ -1,157 +1,888 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"github.com/AvdeevK/url-cutter.git/internal/config"
 	"github.com/AvdeevK/url-cutter.git/internal/logger"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
-	"io"
+	"go.uber.org/zap"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type FileStorage struct {
+	// mu сериализует запись в журнал ссылок, выдачу идентификаторов записей и компактизацию.
+	mu          sync.Mutex
+	lastUUID    int
 	filePath    string
-	urls        map[string]models.OriginalURLSelectionResult
+	file        *os.File
+	syncPolicy  SyncPolicy
+	dirty       bool
+	entries     int
+	clicksPath  string
+	urls        *urlIndex
+	clicksMu    sync.Mutex
+	clicks      clickAggregates
 	storageName string
-}
 
-var lastUUID int
+	deletionsPath string
+	deletionsMu   sync.Mutex
+	deletions     *deletionTasks
+
+	apiKeysPath string
+	apiKeysMu   sync.Mutex
+	apiKeys     *apiKeys
+
+	sessionsPath string
+	sessionsMu   sync.Mutex
+	sessions     *revokedSessions
+
+	usersPath string
+	usersMu   sync.Mutex
+	users     *users
+
+	codeIDs *fileCodeCounter
+}
 
-func NewFileStorage(filePath string) (*FileStorage, error) {
+func NewFileStorage(filePath string, syncPolicy SyncPolicy) (*FileStorage, error) {
 	fs := &FileStorage{
 		filePath:    filePath,
-		urls:        models.PairsOfURLs,
+		syncPolicy:  syncPolicy,
+		clicksPath:  filePath + ".clicks",
+		urls:        newURLIndex(),
+		clicks:      make(clickAggregates),
 		storageName: "file storage",
+
+		deletionsPath: filePath + ".deletions",
+		deletions:     newDeletionTasks(),
+
+		apiKeysPath: filePath + ".apikeys",
+		apiKeys:     newAPIKeys(),
+
+		sessionsPath: filePath + ".sessions",
+		sessions:     newRevokedSessions(),
+
+		usersPath: filePath + ".users",
+		users:     newUsers(),
 	}
-	err := fs.LoadURLsFromFile()
+	if err := fs.LoadURLsFromFile(); err != nil {
+		return fs, err
+	}
+	if err := fs.openLog(); err != nil {
+		return fs, err
+	}
+	if err := fs.loadClicksFromFile(); err != nil {
+		return fs, err
+	}
+	if err := fs.loadDeletionTasksFromFile(); err != nil {
+		return fs, err
+	}
+	if err := fs.loadAPIKeysFromFile(); err != nil {
+		return fs, err
+	}
+	if err := fs.loadRevokedSessionsFromFile(); err != nil {
+		return fs, err
+	}
+	if err := fs.loadUsersFromFile(); err != nil {
+		return fs, err
+	}
+	codeIDs, err := loadFileCodeCounter(filePath + ".seq")
+	fs.codeIDs = codeIDs
 	return fs, err
 }
 
-func (f *FileStorage) SaveURL(shortURL, originalURL, userID string) (string, error) {
-	lastUUID += 1
-
-	record := models.AddNewURLRecord{
-		ID:          strconv.Itoa(lastUUID),
-		ShortURL:    shortURL,
-		OriginalURL: originalURL,
-		UserID:      userID,
+func (f *FileStorage) SaveURL(ctx context.Context, record models.AddNewURLRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return "", f.saveToFile(record)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.saveToFile(record)
 }
 
-func (f *FileStorage) GetOriginalURL(shortURL string) models.OriginalURLSelectionResult {
-	attributes, exists := f.urls[shortURL]
-	if !exists {
-		return models.OriginalURLSelectionResult{
-			OriginalURL: "",
-			IsDeleted:   false,
-			Error:       errors.New("URL not found"),
-			UserID:      "",
+func (f *FileStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
+	return f.urls.selection(shortURL, time.Now())
+}
+
+func (f *FileStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (f *FileStorage) LoadURLsFromFile() error {
+	return readJSONLines(f.filePath, func(line []byte) error {
+		var entry fileLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
 		}
+		f.entries++
+		f.applyEntry(entry)
+		return nil
+	})
+}
+
+func (f *FileStorage) applyEntry(entry fileLogEntry) {
+	switch entry.Op {
+	case fileOpDelete:
+		f.urls.update(entry.ShortURL, func(url *models.OriginalURLSelectionResult) bool {
+			if url.IsDeleted {
+				return false
+			}
+			url.IsDeleted = true
+			url.DeletedAt = entry.DeletedAt
+			return true
+		})
+	case fileOpRestore:
+		f.urls.update(entry.ShortURL, func(url *models.OriginalURLSelectionResult) bool {
+			url.IsDeleted = false
+			url.DeletedAt = nil
+			return true
+		})
+	case fileOpBlock, fileOpUnblock:
+		f.urls.setBlock(entry.ShortURL, entry.BlockedAt, entry.BlockReason)
+	case fileOpFlag:
+		f.urls.setThreat(entry.ShortURL, entry.ThreatType)
+	case fileOpOwner:
+		f.urls.update(entry.ShortURL, func(url *models.OriginalURLSelectionResult) bool {
+			url.UserID = entry.UserID
+			return true
+		})
+	default:
+		record := entry.AddNewURLRecord
+		f.urls.put(record.ShortURL, models.OriginalURLSelectionResult{
+			OriginalURL:  record.OriginalURL,
+			IsDeleted:    record.DeletedFlag,
+			Error:        nil,
+			UserID:       record.UserID,
+			ExpiresAt:    record.ExpiresAt,
+			DeletedAt:    record.DeletedAt,
+			RedirectType: record.RedirectType,
+			BlockedAt:    entry.BlockedAt,
+			BlockReason:  entry.BlockReason,
+			ThreatType:   entry.ThreatType,
+		})
+		id, err := strconv.Atoi(record.ID)
+		if err != nil {
+			logger.Log.Info("can't to get last uuid")
+			return
+		}
+		f.lastUUID = id
 	}
-	return models.OriginalURLSelectionResult{
-		OriginalURL: attributes.OriginalURL,
-		IsDeleted:   attributes.IsDeleted,
-		Error:       attributes.Error,
-		UserID:      attributes.UserID,
+}
+
+func (f *FileStorage) openLog() error {
+	file, err := os.OpenFile(f.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
 	}
+	f.file = file
+	return nil
 }
 
-func (f *FileStorage) Ping() error {
+// saveToFile вызывается под f.mu: запись сначала резервируется в индексе,
+// а при ошибке записи в файл удаляется из него.
+func (f *FileStorage) saveToFile(newURL models.AddNewURLRecord) error {
+	if err := f.urls.insert(newURL.ShortURL, selectionFromRecord(newURL)); err != nil {
+		return err
+	}
+
+	f.lastUUID += 1
+	newURL.ID = strconv.Itoa(f.lastUUID)
+
+	if err := f.appendToFile(fileLogEntry{AddNewURLRecord: newURL}); err != nil {
+		f.urls.remove(newURL.ShortURL)
+		return err
+	}
 	return nil
 }
 
-func (f *FileStorage) LoadURLsFromFile() error {
-	file, err := os.Open(config.Configs.FileStoragePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+// appendToFile вызывается под f.mu и дописывает записи в журнал одним вызовом write.
+func (f *FileStorage) appendToFile(entries ...fileLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
 		}
+	}
+	if _, err := f.file.Write(buf.Bytes()); err != nil {
 		return err
 	}
-	defer file.Close()
+	f.entries += len(entries)
 
-	dec := json.NewDecoder(file)
-	for {
-		var record models.AddNewURLRecord
-		if err := dec.Decode(&record); err == io.EOF {
-			break
-		} else if err != nil {
-			return err
+	switch f.syncPolicy {
+	case SyncAlways:
+		return f.file.Sync()
+	case SyncInterval:
+		f.dirty = true
+	}
+	return nil
+}
+
+func (f *FileStorage) GetStorageName() (string, error) {
+	return f.storageName, nil
+}
+
+func (f *FileStorage) SaveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results, err := f.urls.insertBatch(records)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fileLogEntry, 0, len(records))
+	for n, result := range results {
+		if result.Existing {
+			continue
 		}
-		f.urls[record.ShortURL] = models.OriginalURLSelectionResult{
-			OriginalURL: record.OriginalURL,
-			IsDeleted:   record.DeletedFlag,
-			Error:       nil,
-			UserID:      record.UserID,
+		record := records[n]
+		record.ID = strconv.Itoa(f.lastUUID + len(entries) + 1)
+		entries = append(entries, fileLogEntry{AddNewURLRecord: record})
+	}
+	// Пакет пишется в журнал одним вызовом, чтобы в файл не попала его часть.
+	if err := f.appendToFile(entries...); err != nil {
+		f.urls.removeInserted(results)
+		return nil, err
+	}
+	f.lastUUID += len(entries)
+	return results, nil
+}
+
+func (f *FileStorage) GetAllUserURLs(ctx context.Context, userID string) ([]models.BasePairsOfURLsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return f.urls.userURLs(userID), nil
+}
+
+// MarkURLsAsDeleted меняет индекс и пишет надгробия под f.mu, чтобы порядок
+// записей в журнале совпадал с порядком изменений в памяти.
+func (f *FileStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UTC()
+	results := f.urls.markDeleted(urls, now)
+	entries := make([]fileLogEntry, 0, len(results))
+	for _, result := range results {
+		if result.Status == models.DeletionStatusDeleted {
+			entries = append(entries, deleteEntry(result.ShortURL, now))
 		}
-		lastUUID, err = strconv.Atoi(record.ID)
-		if err != nil {
-			logger.Log.Info("can't to get last uuid")
+	}
+	return results, f.appendToFile(entries...)
+}
+
+func (f *FileStorage) MarkExpiredURLsAsDeleted(ctx context.Context, now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	marked := f.urls.markExpired(now)
+	entries := make([]fileLogEntry, 0, len(marked))
+	for _, shortURL := range marked {
+		entries = append(entries, deleteEntry(shortURL, now))
+	}
+	return int64(len(marked)), f.appendToFile(entries...)
+}
+
+func (f *FileStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := f.urls.restore(userID, shortURLs, deletedAfter, time.Now())
+	entries := make([]fileLogEntry, 0, len(results))
+	for _, result := range results {
+		if result.Status == models.RestoreStatusRestored {
+			entries = append(entries, fileLogEntry{
+				AddNewURLRecord: models.AddNewURLRecord{ShortURL: result.ShortURL},
+				Op:              fileOpRestore,
+			})
 		}
 	}
+	return results, f.appendToFile(entries...)
+}
+
+func deleteEntry(shortURL string, deletedAt time.Time) fileLogEntry {
+	return fileLogEntry{
+		AddNewURLRecord: models.AddNewURLRecord{
+			ShortURL:    shortURL,
+			DeletedFlag: true,
+			DeletedAt:   &deletedAt,
+		},
+		Op: fileOpDelete,
+	}
+}
+
+// PurgeDeletedURLs удаляет ссылки из индекса и переписывает файлы ссылок и переходов без них.
+func (f *FileStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	purged := f.urls.purge(deletedBefore)
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	if err := f.compact(); err != nil {
+		return 0, err
+	}
+	if err := f.purgeClicks(purged); err != nil {
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+// RunMaintenance сбрасывает журнал на диск по политике SyncInterval и периодически
+// компактизирует его, пока не будет отменён ctx. Нулевой интервал отключает задачу.
+func (f *FileStorage) RunMaintenance(ctx context.Context, syncInterval, compactInterval time.Duration) {
+	var syncTick, compactTick <-chan time.Time
+	if f.syncPolicy == SyncInterval && syncInterval > 0 {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+	if compactInterval > 0 {
+		ticker := time.NewTicker(compactInterval)
+		defer ticker.Stop()
+		compactTick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTick:
+			if err := f.Sync(); err != nil {
+				logger.Log.Error("failed to sync url log", zap.Error(err))
+			}
+		case <-compactTick:
+			if err := f.Compact(); err != nil {
+				logger.Log.Error("failed to compact url log", zap.Error(err))
+			}
+		}
+	}
+}
 
+func (f *FileStorage) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.dirty {
+		return nil
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.dirty = false
 	return nil
 }
 
-func (f *FileStorage) saveToFile(newURL models.AddNewURLRecord) error {
-	file, err := os.OpenFile(config.Configs.FileStoragePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Compact переписывает журнал в снимок, если в нём накопились надгробия и устаревшие записи.
+func (f *FileStorage) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.entries <= f.urls.len() {
+		return nil
+	}
+	before := f.entries
+	if err := f.compact(); err != nil {
+		return err
+	}
+	logger.Log.Info("url log compacted", zap.Int("entries_before", before), zap.Int("entries_after", f.entries))
+	return nil
+}
+
+// Close сбрасывает журнал на диск и закрывает его.
+func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// compact вызывается под f.mu: снимок индекса пишется во временный файл,
+// который заменяет журнал через rename, после чего журнал открывается заново.
+func (f *FileStorage) compact() error {
+	records := make([]fileLogEntry, 0)
+	f.urls.forEach(func(shortURL string, url models.OriginalURLSelectionResult) {
+		records = append(records, fileLogEntry{
+			AddNewURLRecord: models.AddNewURLRecord{
+				ShortURL:     shortURL,
+				OriginalURL:  url.OriginalURL,
+				UserID:       url.UserID,
+				DeletedFlag:  url.IsDeleted,
+				DeletedAt:    url.DeletedAt,
+				ExpiresAt:    url.ExpiresAt,
+				RedirectType: url.RedirectType,
+			},
+			BlockedAt:   url.BlockedAt,
+			BlockReason: url.BlockReason,
+			ThreatType:  url.ThreatType,
+		})
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ShortURL < records[j].ShortURL
+	})
+
+	err := rewriteFile(f.filePath, func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for i := range records {
+			records[i].ID = strconv.Itoa(i + 1)
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	if err := f.openLog(); err != nil {
+		return err
+	}
+	f.lastUUID = len(records)
+	f.entries = len(records)
+	f.dirty = false
+	return nil
+}
+
+func (f *FileStorage) purgeClicks(shortURLs []string) error {
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+
+	for _, shortURL := range shortURLs {
+		delete(f.clicks, shortURL)
+	}
+
+	events, err := readClickEvents(f.clicksPath)
+	if err != nil {
+		return err
+	}
+	return rewriteFile(f.clicksPath, func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, event := range events {
+			if _, exists := f.clicks[event.ShortURL]; !exists {
+				continue
+			}
+			if err := enc.Encode(&event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f *FileStorage) SaveClicks(ctx context.Context, events []models.ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+
+	file, err := os.OpenFile(f.clicksPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
 	enc := json.NewEncoder(file)
-	if err := enc.Encode(&newURL); err != nil {
+	for _, event := range events {
+		if err := enc.Encode(&event); err != nil {
+			return err
+		}
+		f.clicks.add(event)
+	}
+	return nil
+}
+
+func (f *FileStorage) GetURLStats(ctx context.Context, shortURL string) (models.URLStats, error) {
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+
+	return f.clicks.get(shortURL), nil
+}
+
+func (f *FileStorage) loadClicksFromFile() error {
+	events, err := readClickEvents(f.clicksPath)
+	if err != nil {
 		return err
 	}
+	for _, event := range events {
+		f.clicks.add(event)
+	}
+	return nil
+}
+
+func readClickEvents(path string) ([]models.ClickEvent, error) {
+	var events []models.ClickEvent
+	err := readJSONLines(path, func(line []byte) error {
+		var event models.ClickEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
 
-	f.urls[newURL.ShortURL] = models.OriginalURLSelectionResult{
-		OriginalURL: newURL.OriginalURL,
-		IsDeleted:   newURL.DeletedFlag,
-		Error:       nil,
-		UserID:      newURL.UserID,
+func (f *FileStorage) SaveDeletionTask(ctx context.Context, task models.DeletionTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+
+	f.deletionsMu.Lock()
+	defer f.deletionsMu.Unlock()
+
+	file, err := os.OpenFile(f.deletionsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(&task); err != nil {
+		return err
+	}
+	// Задача должна пережить падение процесса, поэтому запись сразу сбрасывается на диск.
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	f.deletions.add(task)
 	return nil
 }
 
-func (f *FileStorage) GetStorageName() (string, error) {
-	return f.storageName, nil
+func (f *FileStorage) GetPendingDeletionTasks(ctx context.Context) ([]models.DeletionTask, error) {
+	return f.deletions.list(), nil
 }
 
-func (f *FileStorage) SaveBatch(records []models.AddNewURLRecord) error {
-	for _, record := range records {
-		if err := f.saveToFile(record); err != nil {
+func (f *FileStorage) RemoveDeletionTasks(ctx context.Context, ids []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.deletionsMu.Lock()
+	defer f.deletionsMu.Unlock()
+
+	f.deletions.remove(ids)
+	pending := f.deletions.list()
+	return rewriteFile(f.deletionsPath, func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, task := range pending {
+			if err := enc.Encode(&task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f *FileStorage) loadDeletionTasksFromFile() error {
+	return readJSONLines(f.deletionsPath, func(line []byte) error {
+		var task models.DeletionTask
+		if err := json.Unmarshal(line, &task); err != nil {
 			return err
 		}
+		f.deletions.add(task)
+		return nil
+	})
+}
+
+func (f *FileStorage) ReserveCodeIDs(ctx context.Context, n int) ([]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return f.codeIDs.reserve(n)
+}
+
+func (f *FileStorage) BlockURL(ctx context.Context, shortURL, reason string) error {
+	blockedAt := time.Now().UTC()
+	return f.setBlock(ctx, fileLogEntry{
+		AddNewURLRecord: models.AddNewURLRecord{ShortURL: shortURL},
+		Op:              fileOpBlock,
+		BlockedAt:       &blockedAt,
+		BlockReason:     reason,
+	})
+}
+
+func (f *FileStorage) UnblockURL(ctx context.Context, shortURL string) error {
+	return f.setBlock(ctx, fileLogEntry{
+		AddNewURLRecord: models.AddNewURLRecord{ShortURL: shortURL},
+		Op:              fileOpUnblock,
+	})
+}
+
+func (f *FileStorage) setBlock(ctx context.Context, entry fileLogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.urls.setBlock(entry.ShortURL, entry.BlockedAt, entry.BlockReason) {
+		return ErrNotFound
+	}
+	return f.appendToFile(entry)
+}
+
+func (f *FileStorage) FlagURL(ctx context.Context, shortURL, threatType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.urls.setThreat(shortURL, threatType) {
+		return ErrNotFound
+	}
+	return f.appendToFile(fileLogEntry{
+		AddNewURLRecord: models.AddNewURLRecord{ShortURL: shortURL},
+		Op:              fileOpFlag,
+		ThreatType:      threatType,
+	})
+}
+
+func (f *FileStorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.apiKeysMu.Lock()
+	defer f.apiKeysMu.Unlock()
+
+	file, err := os.OpenFile(f.apiKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+
+	record := fileAPIKey(key)
+	if err := json.NewEncoder(file).Encode(&record); err != nil {
+		return err
+	}
+	// Ключ уже показан пользователю, поэтому терять его при падении нельзя.
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	f.apiKeys.add(key)
 	return nil
 }
 
-func (f *FileStorage) GetAllUserURLs(userID string) ([]models.BasePairsOfURLsResponse, error) {
-	result := make([]models.BasePairsOfURLsResponse, 0)
-	for key, val := range f.urls {
-		if val.UserID == userID && !val.IsDeleted {
-			result = append(result, models.BasePairsOfURLsResponse{
-				OriginalURL: val.OriginalURL,
-				ShortURL:    key,
-			})
-		}
+func (f *FileStorage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	key, exists := f.apiKeys.get(hash)
+	if !exists {
+		return models.APIKey{}, ErrNotFound
 	}
-	return result, nil
+	return key, nil
+}
+
+func (f *FileStorage) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	return f.apiKeys.userKeys(userID), nil
 }
 
-func (f *FileStorage) MarkURLsAsDeleted(userID string, urlIDs []string) error {
-	for _, id := range urlIDs {
-		if url, exists := f.urls[id]; exists {
-			if url.UserID == userID {
-				url.IsDeleted = true
-				f.urls[id] = url
+func (f *FileStorage) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.apiKeysMu.Lock()
+	defer f.apiKeysMu.Unlock()
+
+	if !f.apiKeys.revoke(userID, id, time.Now().UTC()) {
+		return ErrNotFound
+	}
+	keys := f.apiKeys.list()
+	return rewriteFile(f.apiKeysPath, func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, key := range keys {
+			record := fileAPIKey(key)
+			if err := enc.Encode(&record); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+}
+
+func (f *FileStorage) loadAPIKeysFromFile() error {
+	return readJSONLines(f.apiKeysPath, func(line []byte) error {
+		var record fileAPIKey
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		f.apiKeys.add(models.APIKey(record))
+		return nil
+	})
+}
+
+func (f *FileStorage) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.sessionsMu.Lock()
+	defer f.sessionsMu.Unlock()
+
+	// Истёкшие записи выбрасываются из файла при той же записи, отдельная чистка не нужна.
+	if pruned := f.sessions.add(sessionID, expiresAt, time.Now()); pruned > 0 {
+		sessions := f.sessions.list()
+		return rewriteFile(f.sessionsPath, func(w *bufio.Writer) error {
+			enc := json.NewEncoder(w)
+			for _, session := range sessions {
+				if err := enc.Encode(&session); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
+
+	file, err := os.OpenFile(f.sessionsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(&revokedSession{SessionID: sessionID, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (f *FileStorage) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return f.sessions.revoked(sessionID, time.Now()), nil
+}
+
+func (f *FileStorage) loadRevokedSessionsFromFile() error {
+	now := time.Now()
+	return readJSONLines(f.sessionsPath, func(line []byte) error {
+		var session revokedSession
+		if err := json.Unmarshal(line, &session); err != nil {
+			return err
+		}
+		f.sessions.add(session.SessionID, session.ExpiresAt, now)
+		return nil
+	})
+}
+
+func (f *FileStorage) CreateUser(ctx context.Context, user models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.usersMu.Lock()
+	defer f.usersMu.Unlock()
+
+	if _, exists := f.users.getByLogin(user.Login); exists {
+		return ErrLoginTaken
+	}
+
+	file, err := os.OpenFile(f.usersPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	record := fileUser(user)
+	if err := json.NewEncoder(file).Encode(&record); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	f.users.add(user)
 	return nil
 }
+
+func (f *FileStorage) GetUser(ctx context.Context, id string) (models.User, error) {
+	user, exists := f.users.get(id)
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (f *FileStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	user, exists := f.users.getByLogin(login)
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (f *FileStorage) loadUsersFromFile() error {
+	return readJSONLines(f.usersPath, func(line []byte) error {
+		var record fileUser
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		f.users.add(models.User(record))
+		return nil
+	})
+}
+
+func (f *FileStorage) ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	moved := f.urls.reassign(fromUserID, toUserID)
+	entries := make([]fileLogEntry, 0, len(moved))
+	for _, shortURL := range moved {
+		entries = append(entries, fileLogEntry{
+			AddNewURLRecord: models.AddNewURLRecord{ShortURL: shortURL, UserID: toUserID},
+			Op:              fileOpOwner,
+		})
+	}
+	return int64(len(moved)), f.appendToFile(entries...)
+}
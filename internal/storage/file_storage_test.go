@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestFileStoragePersistsTombstones(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	for _, shortURL := range []string{"deleted", "restored", "kept"} {
+		require.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{
+			ShortURL:    shortURL,
+			OriginalURL: "https://example.com/" + shortURL,
+			UserID:      "alice",
+		}))
+	}
+	_, err = fs.MarkURLsAsDeleted(ctx, []models.URLToDelete{
+		{UserID: "alice", ShortURL: "deleted"},
+		{UserID: "alice", ShortURL: "restored"},
+	})
+	require.NoError(t, err)
+	_, err = fs.RestoreURLs(ctx, "alice", []string{"restored"}, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	assert.ErrorIs(t, reloaded.GetOriginalURL(ctx, "deleted").Error, ErrGone)
+	assert.NoError(t, reloaded.GetOriginalURL(ctx, "restored").Error)
+	assert.NoError(t, reloaded.GetOriginalURL(ctx, "kept").Error)
+
+	require.NoError(t, reloaded.Compact())
+	assert.Equal(t, 3, countLines(t, path))
+	assert.ErrorIs(t, reloaded.GetOriginalURL(ctx, "deleted").Error, ErrGone)
+
+	// После компактизации журнал снова принимает записи.
+	require.NoError(t, reloaded.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL:    "after",
+		OriginalURL: "https://example.com/after",
+		UserID:      "alice",
+	}))
+	assert.Equal(t, 4, countLines(t, path))
+}
+
+func TestFileStorageToleratesTruncatedLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	content := `{"correlation_id":"1","short_url":"first","original_url":"https://example.com/1","user_id":"alice","is_deleted":false}
+{"correlation_id":"2","short_url":"sec`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer fs.Close()
+
+	assert.NoError(t, fs.GetOriginalURL(ctx, "first").Error)
+	require.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL:    "second",
+		OriginalURL: "https://example.com/2",
+		UserID:      "alice",
+	}))
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+	assert.NoError(t, reloaded.GetOriginalURL(ctx, "second").Error)
+}
+
+func TestFileStorageRejectsCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	content := "not json\n" +
+		`{"correlation_id":"1","short_url":"first","original_url":"https://example.com/1","user_id":"alice","is_deleted":false}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	_, err := NewFileStorage(path, SyncAlways)
+	assert.Error(t, err)
+}
+
+func TestFileStorageCodeIDsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	ids, err := fs.ReserveCodeIDs(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+	require.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	ids, err = reloaded.ReserveCodeIDs(ctx, 1)
+	require.NoError(t, err)
+	assert.Greater(t, ids[0], int64(2))
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// rewriteFile атомарно заменяет содержимое файла: данные пишутся во временный файл
+// в том же каталоге, который после fsync переименовывается поверх исходного.
+func rewriteFile(path string, write func(w *bufio.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readJSONLines передаёт fn каждую строку файла. Недописанная последняя строка,
+// оставшаяся после падения процесса, отбрасывается, и файл обрезается до последней
+// целой записи; повреждение в середине файла считается ошибкой.
+func readJSONLines(path string, fn func(line []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var valid int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		complete := err == nil
+		if len(bytes.TrimSpace(line)) > 0 {
+			if parseErr := fn(line); parseErr != nil {
+				if complete {
+					return fmt.Errorf("%s: corrupted record at offset %d: %w", path, valid, parseErr)
+				}
+				logger.Log.Warn("dropping truncated record", zap.String("file", path), zap.Int64("offset", valid))
+				return os.Truncate(path, valid)
+			}
+		}
+		if !complete {
+			if len(line) > 0 {
+				// Последняя запись цела, но без перевода строки: дописываем его,
+				// чтобы следующая запись не склеилась с ней.
+				return appendNewline(path)
+			}
+			return nil
+		}
+		valid += int64(len(line))
+	}
+}
+
+func appendNewline(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write([]byte{'\n'})
+	return err
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"go.uber.org/zap"
+	"time"
+)
+
+// RunJanitor периодически помечает просроченные ссылки как удалённые, пока не будет отменён ctx.
+func RunJanitor(ctx context.Context, s Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			opCtx, cancel := OperationContext(ctx)
+			marked, err := s.MarkExpiredURLsAsDeleted(opCtx, now)
+			cancel()
+			if err != nil {
+				logger.Log.Error("failed to mark expired urls as deleted", zap.Error(err))
+				continue
+			}
+			if marked > 0 {
+				logger.Log.Info("expired urls marked as deleted", zap.Int64("count", marked))
+			}
+		}
+	}
+}
+
+// RunPurger периодически физически удаляет ссылки, у которых истекло окно восстановления.
+func RunPurger(ctx context.Context, s Storage, interval, restoreWindow time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			opCtx, cancel := OperationContext(ctx)
+			purged, err := s.PurgeDeletedURLs(opCtx, now.Add(-restoreWindow))
+			cancel()
+			if err != nil {
+				logger.Log.Error("failed to purge deleted urls", zap.Error(err))
+				continue
+			}
+			if purged > 0 {
+				logger.Log.Info("deleted urls purged", zap.Int64("count", purged))
+			}
+		}
+	}
+}
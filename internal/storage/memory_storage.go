@@ -1,50 +1,56 @@
 package storage
 
 import (
-	"errors"
+	"context"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type MemoryStorage struct {
-	urls        map[string]models.OriginalURLSelectionResult
+	urls        *urlIndex
+	clicksMu    sync.Mutex
+	clicks      clickAggregates
+	deletions   *deletionTasks
+	codeIDs     atomic.Int64
+	apiKeys     *apiKeys
+	sessions    *revokedSessions
+	users       *users
 	storageName string
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		urls:        models.PairsOfURLs,
+		urls:        newURLIndex(),
+		clicks:      make(clickAggregates),
+		deletions:   newDeletionTasks(),
+		apiKeys:     newAPIKeys(),
+		sessions:    newRevokedSessions(),
+		users:       newUsers(),
 		storageName: "memory storage",
 	}
 }
 
-func (m *MemoryStorage) SaveURL(shortURL, originalURL string, userID string) (string, error) {
-	m.urls[shortURL] = models.OriginalURLSelectionResult{
-		OriginalURL: originalURL,
-		IsDeleted:   false,
-		UserID:      userID,
+func (m *MemoryStorage) SaveURL(ctx context.Context, record models.AddNewURLRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	return "", nil
+
+	return m.urls.insert(record.ShortURL, models.OriginalURLSelectionResult{
+		OriginalURL:  record.OriginalURL,
+		IsDeleted:    false,
+		UserID:       record.UserID,
+		ExpiresAt:    record.ExpiresAt,
+		RedirectType: record.RedirectType,
+	})
 }
 
-func (m *MemoryStorage) GetOriginalURL(shortURL string) models.OriginalURLSelectionResult {
-	attributes, exists := m.urls[shortURL]
-	if !exists {
-		return models.OriginalURLSelectionResult{
-			OriginalURL: "",
-			IsDeleted:   false,
-			Error:       errors.New("URL not found"),
-			UserID:      "",
-		}
-	}
-	return models.OriginalURLSelectionResult{
-		OriginalURL: attributes.OriginalURL,
-		IsDeleted:   attributes.IsDeleted,
-		Error:       attributes.Error,
-		UserID:      attributes.UserID,
-	}
+func (m *MemoryStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
+	return m.urls.selection(shortURL, time.Now())
 }
 
-func (m *MemoryStorage) Ping() error {
+func (m *MemoryStorage) Ping(ctx context.Context) error {
 	return nil
 }
 
@@ -52,38 +58,184 @@ func (m *MemoryStorage) GetStorageName() (string, error) {
 	return m.storageName, nil
 }
 
-func (m *MemoryStorage) SaveBatch(records []models.AddNewURLRecord) error {
-	for _, record := range records {
-		m.urls[record.ShortURL] = models.OriginalURLSelectionResult{
-			OriginalURL: record.OriginalURL,
-			IsDeleted:   record.DeletedFlag,
-			UserID:      record.UserID,
-		}
+func (m *MemoryStorage) SaveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.urls.insertBatch(records)
+}
+
+func (m *MemoryStorage) GetAllUserURLs(ctx context.Context, userID string) ([]models.BasePairsOfURLsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.urls.userURLs(userID), nil
+}
+
+func (m *MemoryStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.urls.markDeleted(urls, time.Now().UTC()), nil
+}
+
+func (m *MemoryStorage) MarkExpiredURLsAsDeleted(ctx context.Context, now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(m.urls.markExpired(now))), nil
+}
+
+func (m *MemoryStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.urls.restore(userID, shortURLs, deletedAfter, time.Now()), nil
+}
+
+func (m *MemoryStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := m.urls.purge(deletedBefore)
+
+	m.clicksMu.Lock()
+	defer m.clicksMu.Unlock()
+
+	for _, shortURL := range purged {
+		delete(m.clicks, shortURL)
+	}
+	return int64(len(purged)), nil
+}
+
+func (m *MemoryStorage) SaveClicks(ctx context.Context, events []models.ClickEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.clicksMu.Lock()
+	defer m.clicksMu.Unlock()
+
+	for _, event := range events {
+		m.clicks.add(event)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetURLStats(ctx context.Context, shortURL string) (models.URLStats, error) {
+	m.clicksMu.Lock()
+	defer m.clicksMu.Unlock()
+
+	return m.clicks.get(shortURL), nil
+}
+
+func (m *MemoryStorage) SaveDeletionTask(ctx context.Context, task models.DeletionTask) error {
+	m.deletions.add(task)
+	return nil
+}
+
+func (m *MemoryStorage) GetPendingDeletionTasks(ctx context.Context) ([]models.DeletionTask, error) {
+	return m.deletions.list(), nil
+}
+
+func (m *MemoryStorage) RemoveDeletionTasks(ctx context.Context, ids []string) error {
+	m.deletions.remove(ids)
+	return nil
+}
+
+func (m *MemoryStorage) ReserveCodeIDs(ctx context.Context, n int) ([]int64, error) {
+	last := m.codeIDs.Add(int64(n))
+	return codeIDRange(last-int64(n)+1, n), nil
+}
+
+func (m *MemoryStorage) BlockURL(ctx context.Context, shortURL, reason string) error {
+	blockedAt := time.Now().UTC()
+	if !m.urls.setBlock(shortURL, &blockedAt, reason) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MemoryStorage) UnblockURL(ctx context.Context, shortURL string) error {
+	if !m.urls.setBlock(shortURL, nil, "") {
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (m *MemoryStorage) GetAllUserURLs(userID string) ([]models.BasePairsOfURLsResponse, error) {
-	result := make([]models.BasePairsOfURLsResponse, 0)
-	for key, val := range m.urls {
-		if val.UserID == userID && !val.IsDeleted {
-			result = append(result, models.BasePairsOfURLsResponse{
-				OriginalURL: val.OriginalURL,
-				ShortURL:    key,
-			})
-		}
+func (m *MemoryStorage) FlagURL(ctx context.Context, shortURL, threatType string) error {
+	if !m.urls.setThreat(shortURL, threatType) {
+		return ErrNotFound
 	}
-	return result, nil
+	return nil
+}
+
+func (m *MemoryStorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	m.apiKeys.add(key)
+	return nil
+}
+
+func (m *MemoryStorage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	key, exists := m.apiKeys.get(hash)
+	if !exists {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *MemoryStorage) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	return m.apiKeys.userKeys(userID), nil
 }
 
-func (m *MemoryStorage) MarkURLsAsDeleted(userID string, urlIDs []string) error {
-	for _, id := range urlIDs {
-		if url, exists := m.urls[id]; exists {
-			if url.UserID == userID {
-				url.IsDeleted = true
-				m.urls[id] = url
-			}
-		}
+func (m *MemoryStorage) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	if !m.apiKeys.revoke(userID, id, time.Now().UTC()) {
+		return ErrNotFound
 	}
 	return nil
 }
+
+func (m *MemoryStorage) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	m.sessions.add(sessionID, expiresAt, time.Now())
+	return nil
+}
+
+func (m *MemoryStorage) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	return m.sessions.revoked(sessionID, time.Now()), nil
+}
+
+func (m *MemoryStorage) CreateUser(ctx context.Context, user models.User) error {
+	if !m.users.add(user) {
+		return ErrLoginTaken
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetUser(ctx context.Context, id string) (models.User, error) {
+	user, exists := m.users.get(id)
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	user, exists := m.users.getByLogin(login)
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStorage) ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(m.urls.reassign(fromUserID, toUserID))), nil
+}
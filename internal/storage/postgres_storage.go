@@ -1,11 +1,21 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lib/pq"
 	"log"
+	"time"
+)
+
+const (
+	uniqueViolationCode   = "23505"
+	shortURLConstraintKey = "urls_short_url_key"
+	loginConstraintKey    = "users_login_key"
 )
 
 type PostgresStorage struct {
@@ -20,114 +30,638 @@ func NewPostgresStorage(db *sql.DB) *PostgresStorage {
 	}
 }
 
-func (db *PostgresStorage) SaveURL(shortURL, originalURL, userID string) (string, error) {
+func (db *PostgresStorage) SaveURL(ctx context.Context, record models.AddNewURLRecord) error {
 	query := `
-        INSERT INTO urls (user_id, short_url, original_url)
-        VALUES ($1, $2, $3)
+        INSERT INTO urls (user_id, short_url, original_url, expires_at, redirect_type)
+        VALUES ($1, $2, $3, $4, NULLIF($5, 0))
         ON CONFLICT (original_url) DO NOTHING
         RETURNING short_url;
     `
 
-	var existingShortURL string
-	err := db.db.QueryRow(query, userID, shortURL, originalURL).Scan(&existingShortURL)
+	var savedShortURL string
+	err := db.db.QueryRowContext(ctx, query, record.UserID, record.ShortURL, record.OriginalURL, record.ExpiresAt, record.RedirectType).Scan(&savedShortURL)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return db.GetShortURLByOriginal(originalURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			existingShortURL, err := db.GetShortURLByOriginal(ctx, record.OriginalURL)
+			if err != nil {
+				return err
+			}
+			return &ConflictError{ShortURL: existingShortURL}
 		}
-		return "", err
+		if isShortURLViolation(err) {
+			return ErrShortURLTaken
+		}
+		return err
 	}
-	return existingShortURL, nil
+	return nil
 }
 
-func (db *PostgresStorage) GetOriginalURL(shortURL string) models.OriginalURLSelectionResult {
+func (db *PostgresStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
 	var (
-		originalURL string
-		isDeleted   bool
+		originalURL  string
+		isDeleted    bool
+		expiresAt    sql.NullTime
+		deletedAt    sql.NullTime
+		userID       string
+		redirectType sql.NullInt32
+		blockedAt    sql.NullTime
+		blockReason  sql.NullString
+		threatType   sql.NullString
 	)
-	err := db.db.QueryRow("SELECT original_url, is_deleted FROM urls WHERE short_url = $1", shortURL).Scan(&originalURL, &isDeleted)
-	if err == sql.ErrNoRows {
+	query := `
+		SELECT original_url, is_deleted, expires_at, deleted_at, user_id, redirect_type, blocked_at, block_reason, threat_type
+		FROM urls WHERE short_url = $1
+	`
+	err := db.db.QueryRowContext(ctx, query, shortURL).Scan(&originalURL, &isDeleted, &expiresAt, &deletedAt, &userID,
+		&redirectType, &blockedAt, &blockReason, &threatType)
+	if errors.Is(err, sql.ErrNoRows) {
 		return models.OriginalURLSelectionResult{
 			OriginalURL: "",
 			IsDeleted:   false,
-			Error:       errors.New("not found"),
+			Error:       ErrNotFound,
 		}
 	}
-	return models.OriginalURLSelectionResult{
-		OriginalURL: originalURL,
-		IsDeleted:   isDeleted,
-		Error:       nil,
+	if err != nil {
+		return models.OriginalURLSelectionResult{Error: err}
+	}
+	result := models.OriginalURLSelectionResult{
+		OriginalURL:  originalURL,
+		IsDeleted:    isDeleted,
+		Error:        nil,
+		UserID:       userID,
+		RedirectType: int(redirectType.Int32),
+		BlockReason:  blockReason.String,
+		ThreatType:   threatType.String,
+	}
+	if expiresAt.Valid {
+		result.ExpiresAt = &expiresAt.Time
+	}
+	if deletedAt.Valid {
+		result.DeletedAt = &deletedAt.Time
 	}
+	if blockedAt.Valid {
+		result.BlockedAt = &blockedAt.Time
+	}
+	return withSelectionState(result, time.Now())
 }
 
-func (db *PostgresStorage) GetShortURLByOriginal(originalURL string) (string, error) {
+func (db *PostgresStorage) GetShortURLByOriginal(ctx context.Context, originalURL string) (string, error) {
 	query := `
         SELECT short_url FROM urls WHERE original_url = $1;
     `
 	var shortURL string
-	err := db.db.QueryRow(query, originalURL).Scan(&shortURL)
+	err := db.db.QueryRowContext(ctx, query, originalURL).Scan(&shortURL)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
 		}
 		return "", err
 	}
-	return shortURL, errors.New("conflict")
+	return shortURL, nil
 }
 
-func (db *PostgresStorage) Ping() error {
-	return db.db.Ping()
+func (db *PostgresStorage) Ping(ctx context.Context) error {
+	return db.db.PingContext(ctx)
 }
 
 func (db *PostgresStorage) GetStorageName() (string, error) {
 	return db.storageName, nil
 }
 
-func (db *PostgresStorage) SaveBatch(records []models.AddNewURLRecord) error {
+// SaveBatch вставляет весь пакет одним запросом в транзакции. Для уже сокращённых
+// URL, в том числе повторяющихся внутри пакета, возвращается существующий код.
+func (db *PostgresStorage) SaveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	userIDs := make([]string, 0, len(records))
+	shortURLs := make([]string, 0, len(records))
+	originalURLs := make([]string, 0, len(records))
+	expiresAt := make([]sql.NullString, 0, len(records))
+	redirectTypes := make([]int64, 0, len(records))
 	for _, record := range records {
-		query := "INSERT INTO urls (user_id, short_url, original_url) VALUES ($1, $2, $3)"
-		_, err := db.db.Exec(query, record.UserID, record.ShortURL, record.OriginalURL)
+		userIDs = append(userIDs, record.UserID)
+		shortURLs = append(shortURLs, record.ShortURL)
+		originalURLs = append(originalURLs, record.OriginalURL)
+		redirectTypes = append(redirectTypes, int64(record.RedirectType))
+		if record.ExpiresAt != nil {
+			expiresAt = append(expiresAt, sql.NullString{String: record.ExpiresAt.Format(time.RFC3339Nano), Valid: true})
+		} else {
+			expiresAt = append(expiresAt, sql.NullString{})
+		}
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Итоговый SELECT видит таблицу до вставки, поэтому новые строки берутся из RETURNING,
+	// а уже существующие — из самой таблицы.
+	query := `
+		WITH input AS (
+			SELECT *
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]::timestamptz[], $5::int[])
+				WITH ORDINALITY AS i(user_id, short_url, original_url, expires_at, redirect_type, ord)
+		), ins AS (
+			INSERT INTO urls (user_id, short_url, original_url, expires_at, redirect_type)
+			SELECT DISTINCT ON (original_url) user_id, short_url, original_url, expires_at, NULLIF(redirect_type, 0)
+			FROM input
+			ORDER BY original_url, ord
+			ON CONFLICT (original_url) DO NOTHING
+			RETURNING short_url, original_url
+		)
+		SELECT input.ord, COALESCE(ins.short_url, u.short_url, ''), COALESCE(ins.short_url = input.short_url, FALSE)
+		FROM input
+		LEFT JOIN ins ON ins.original_url = input.original_url
+		LEFT JOIN urls u ON u.original_url = input.original_url
+		ORDER BY input.ord;
+	`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(userIDs), pq.Array(shortURLs), pq.Array(originalURLs), pq.Array(expiresAt), pq.Array(redirectTypes))
+	if err != nil {
+		if isShortURLViolation(err) {
+			return nil, ErrShortURLTaken
+		}
+		return nil, err
+	}
+
+	results := make([]models.BatchSaveResult, len(records))
+	for rows.Next() {
+		var (
+			ord     int
+			result  models.BatchSaveResult
+			created bool
+		)
+		if err := rows.Scan(&ord, &result.ShortURL, &created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Existing = !created
+		results[ord-1] = result
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		if isShortURLViolation(err) {
+			return nil, ErrShortURLTaken
+		}
+		return nil, err
+	}
+
+	// Строку могла вставить параллельная транзакция уже после снимка запроса.
+	for i, result := range results {
+		if result.ShortURL != "" {
+			continue
+		}
+		err := tx.QueryRowContext(ctx, "SELECT short_url FROM urls WHERE original_url = $1", records[i].OriginalURL).Scan(&results[i].ShortURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		results[i].Existing = true
 	}
-	return nil
+	return results, tx.Commit()
 }
 
-func (db *PostgresStorage) GetAllUserURLs(userID string) ([]models.BasePairsOfURLsResponse, error) {
+func (db *PostgresStorage) GetAllUserURLs(ctx context.Context, userID string) ([]models.BasePairsOfURLsResponse, error) {
 	query := `SELECT short_url, original_url FROM urls WHERE user_id = $1`
-	rows, err := db.db.Query(query, userID)
+	rows, err := db.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if cerr := rows.Close(); cerr != nil {
 			log.Printf("Error closing rows: %v", cerr)
 		}
 	}()
+
+	var records []models.BasePairsOfURLsResponse
+	for rows.Next() {
+		var record models.BasePairsOfURLsResponse
+		if err := rows.Scan(&record.ShortURL, &record.OriginalURL); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (db *PostgresStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	userIDs := make([]string, 0, len(urls))
+	shortURLs := make([]string, 0, len(urls))
+	for _, url := range urls {
+		userIDs = append(userIDs, url.UserID)
+		shortURLs = append(shortURLs, url.ShortURL)
+	}
+
+	query := `
+		WITH req AS (
+			SELECT DISTINCT user_id, short_url
+			FROM unnest($1::text[], $2::text[]) AS r(user_id, short_url)
+		), upd AS (
+			UPDATE urls
+			SET is_deleted = TRUE, deleted_at = COALESCE(urls.deleted_at, now())
+			FROM req
+			WHERE urls.user_id = req.user_id AND urls.short_url = req.short_url
+			RETURNING urls.user_id, urls.short_url
+		)
+		SELECT req.user_id, req.short_url,
+			CASE
+				WHEN upd.short_url IS NOT NULL THEN 'deleted'
+				WHEN u.short_url IS NULL THEN 'not_found'
+				ELSE 'not_owned'
+			END
+		FROM req
+		LEFT JOIN upd ON upd.user_id = req.user_id AND upd.short_url = req.short_url
+		LEFT JOIN urls u ON u.short_url = req.short_url;
+	`
+	rows, err := db.db.QueryContext(ctx, query, pq.Array(userIDs), pq.Array(shortURLs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]models.DeletionResult, 0, len(urls))
+	for rows.Next() {
+		var result models.DeletionResult
+		if err := rows.Scan(&result.UserID, &result.ShortURL, &result.Status); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func (db *PostgresStorage) MarkExpiredURLsAsDeleted(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+		UPDATE urls
+		SET is_deleted = TRUE, deleted_at = $1
+		WHERE expires_at <= $1 AND is_deleted IS NOT TRUE;
+	`
+	res, err := db.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *PostgresStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error) {
+	// Итоговый SELECT видит строки в состоянии до UPDATE, поэтому по ним можно понять причину отказа.
+	query := `
+		WITH req AS (
+			SELECT DISTINCT short_url FROM unnest($2::text[]) AS r(short_url)
+		), upd AS (
+			UPDATE urls
+			SET is_deleted = FALSE, deleted_at = NULL
+			FROM req
+			WHERE urls.short_url = req.short_url AND urls.user_id = $1 AND urls.is_deleted
+				AND urls.deleted_at >= $3 AND (urls.expires_at IS NULL OR urls.expires_at > now())
+			RETURNING urls.short_url
+		)
+		SELECT req.short_url,
+			CASE
+				WHEN upd.short_url IS NOT NULL THEN 'restored'
+				WHEN u.short_url IS NULL THEN 'not_found'
+				WHEN u.user_id <> $1 THEN 'not_owned'
+				WHEN u.is_deleted IS NOT TRUE THEN 'not_deleted'
+				WHEN u.expires_at <= now() THEN 'expired'
+				ELSE 'restore_window_expired'
+			END
+		FROM req
+		LEFT JOIN upd ON upd.short_url = req.short_url
+		LEFT JOIN urls u ON u.short_url = req.short_url;
+	`
+	rows, err := db.db.QueryContext(ctx, query, userID, pq.Array(shortURLs), deletedAfter)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	statuses := make(map[string]string, len(shortURLs))
+	for rows.Next() {
+		var shortURL, status string
+		if err := rows.Scan(&shortURL, &status); err != nil {
+			return nil, err
+		}
+		statuses[shortURL] = status
+	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	var records []models.BasePairsOfURLsResponse
+	results := make([]models.RestoreResult, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		results = append(results, models.RestoreResult{ShortURL: shortURL, Status: statuses[shortURL]})
+	}
+	return results, nil
+}
+
+func (db *PostgresStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM urls
+			WHERE is_deleted AND deleted_at < $1
+			RETURNING short_url
+		), dropped AS (
+			DELETE FROM clicks USING purged WHERE clicks.short_url = purged.short_url
+		)
+		SELECT count(*) FROM purged;
+	`
+	var purged int64
+	err := db.db.QueryRowContext(ctx, query, deletedBefore).Scan(&purged)
+	return purged, err
+}
+
+func (db *PostgresStorage) SaveClicks(ctx context.Context, events []models.ClickEvent) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, client_ip)
+		VALUES ($1, $2, $3, $4, $5);
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if _, err := stmt.ExecContext(ctx, event.ShortURL, event.ClickedAt, event.Referrer, event.UserAgent, event.ClientIP); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *PostgresStorage) GetURLStats(ctx context.Context, shortURL string) (models.URLStats, error) {
+	stats := models.URLStats{
+		ShortURL: shortURL,
+		Days:     make([]models.DailyClicks, 0),
+	}
+
+	var lastClick sql.NullTime
+	query := "SELECT count(*), max(clicked_at) FROM clicks WHERE short_url = $1"
+	if err := db.db.QueryRowContext(ctx, query, shortURL).Scan(&stats.TotalClicks, &lastClick); err != nil {
+		return stats, err
+	}
+	if lastClick.Valid {
+		stats.LastClickAt = &lastClick.Time
+	}
+
+	query = `
+		SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, count(*)
+		FROM clicks
+		WHERE short_url = $1
+		GROUP BY day
+		ORDER BY day;
+	`
+	rows, err := db.db.QueryContext(ctx, query, shortURL)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var record models.BasePairsOfURLsResponse
-		if err := rows.Scan(&record.ShortURL, &record.OriginalURL); err != nil {
+		var day models.DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
+			return stats, err
+		}
+		stats.Days = append(stats.Days, day)
+	}
+	return stats, rows.Err()
+}
+
+func (db *PostgresStorage) SaveDeletionTask(ctx context.Context, task models.DeletionTask) error {
+	shortURLs, err := json.Marshal(task.ShortURLs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO deletion_tasks (id, user_id, short_urls, created_at)
+		VALUES ($1, $2, $3::jsonb, $4);
+	`
+	_, err = db.db.ExecContext(ctx, query, task.ID, task.UserID, string(shortURLs), task.CreatedAt)
+	return err
+}
+
+func (db *PostgresStorage) GetPendingDeletionTasks(ctx context.Context) ([]models.DeletionTask, error) {
+	query := `SELECT id, user_id, short_urls::text, created_at FROM deletion_tasks ORDER BY created_at`
+	rows, err := db.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.DeletionTask
+	for rows.Next() {
+		var (
+			task      models.DeletionTask
+			shortURLs string
+		)
+		if err := rows.Scan(&task.ID, &task.UserID, &shortURLs, &task.CreatedAt); err != nil {
 			return nil, err
 		}
-		records = append(records, record)
+		if err := json.Unmarshal([]byte(shortURLs), &task.ShortURLs); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
 	}
+	return tasks, rows.Err()
+}
 
-	return records, nil
+func (db *PostgresStorage) RemoveDeletionTasks(ctx context.Context, ids []string) error {
+	_, err := db.db.ExecContext(ctx, "DELETE FROM deletion_tasks WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
+
+func isShortURLViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == shortURLConstraintKey
+}
+
+func (db *PostgresStorage) ReserveCodeIDs(ctx context.Context, n int) ([]int64, error) {
+	rows, err := db.db.QueryContext(ctx, "SELECT nextval('url_code_seq') FROM generate_series(1, $1)", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (db *PostgresStorage) BlockURL(ctx context.Context, shortURL, reason string) error {
+	return db.updateURL(ctx, "UPDATE urls SET blocked_at = now(), block_reason = $2 WHERE short_url = $1", shortURL, reason)
 }
 
-func (db *PostgresStorage) MarkURLsAsDeleted(userID string, urlIDs []string) error {
+func (db *PostgresStorage) UnblockURL(ctx context.Context, shortURL string) error {
+	return db.updateURL(ctx, "UPDATE urls SET blocked_at = NULL, block_reason = NULL WHERE short_url = $1", shortURL)
+}
+
+// updateURL меняет одну ссылку и возвращает ErrNotFound, если такой ссылки нет.
+func (db *PostgresStorage) updateURL(ctx context.Context, query string, args ...any) error {
+	result, err := db.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *PostgresStorage) FlagURL(ctx context.Context, shortURL, threatType string) error {
+	return db.updateURL(ctx, "UPDATE urls SET threat_type = NULLIF($2, '') WHERE short_url = $1", shortURL, threatType)
+}
+
+func (db *PostgresStorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
 	query := `
-		UPDATE urls
-		SET is_deleted = TRUE
-		WHERE user_id = $1 AND short_url = ANY($2);
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
 	`
-	_, err := db.db.Exec(query, userID, pq.Array(urlIDs))
+	_, err := db.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.CreatedAt)
 	return err
 }
+
+func (db *PostgresStorage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	query := `SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at FROM api_keys WHERE key_hash = $1`
+	key, err := scanPostgresAPIKey(db.db.QueryRowContext(ctx, query, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, err
+}
+
+func (db *PostgresStorage) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at;
+	`
+	rows, err := db.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanPostgresAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (db *PostgresStorage) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 AND user_id = $2"
+	result, err := db.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanPostgresAPIKey(row interface{ Scan(dest ...any) error }) (models.APIKey, error) {
+	var (
+		key       models.APIKey
+		revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &key.CreatedAt, &revokedAt); err != nil {
+		return models.APIKey{}, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (db *PostgresStorage) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Истёкшие записи больше ничего не защищают и удаляются заодно.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM revoked_sessions WHERE expires_at <= now()"); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO revoked_sessions (session_id, expires_at) VALUES ($1, $2)
+		ON CONFLICT (session_id) DO UPDATE SET expires_at = GREATEST(revoked_sessions.expires_at, EXCLUDED.expires_at);
+	`
+	if _, err := tx.ExecContext(ctx, query, sessionID, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *PostgresStorage) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	var revoked bool
+	query := "SELECT EXISTS (SELECT 1 FROM revoked_sessions WHERE session_id = $1 AND expires_at > now())"
+	err := db.db.QueryRowContext(ctx, query, sessionID).Scan(&revoked)
+	return revoked, err
+}
+
+func (db *PostgresStorage) CreateUser(ctx context.Context, user models.User) error {
+	query := "INSERT INTO users (id, login, password_hash, created_at) VALUES ($1, $2, $3, $4)"
+	_, err := db.db.ExecContext(ctx, query, user.ID, user.Login, user.PasswordHash, user.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == loginConstraintKey {
+		return ErrLoginTaken
+	}
+	return err
+}
+
+func (db *PostgresStorage) GetUser(ctx context.Context, id string) (models.User, error) {
+	return db.getUser(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE id = $1", id)
+}
+
+func (db *PostgresStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	return db.getUser(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE login = $1", login)
+}
+
+func (db *PostgresStorage) getUser(ctx context.Context, query string, arg string) (models.User, error) {
+	var user models.User
+	err := db.db.QueryRowContext(ctx, query, arg).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrNotFound
+	}
+	return user, err
+}
+
+func (db *PostgresStorage) ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	result, err := db.db.ExecContext(ctx, "UPDATE urls SET user_id = $2 WHERE user_id = $1", fromUserID, toUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
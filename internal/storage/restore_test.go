@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageRestoreAndPurge(t *testing.T) {
+	for name, s := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, shortURL := range []string{"keep", "restore", "purge"} {
+				assert.NoError(t, s.SaveURL(ctx, models.AddNewURLRecord{
+					ShortURL:    shortURL,
+					OriginalURL: "https://example.com/" + shortURL,
+					UserID:      "alice",
+				}))
+			}
+			_, err := s.MarkURLsAsDeleted(ctx, []models.URLToDelete{
+				{UserID: "alice", ShortURL: "restore"},
+				{UserID: "alice", ShortURL: "purge"},
+			})
+			assert.NoError(t, err)
+
+			results, err := s.RestoreURLs(ctx, "bob", []string{"restore"}, time.Now().Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, models.DeletionStatusNotOwned, results[0].Status)
+
+			results, err = s.RestoreURLs(ctx, "alice", []string{"restore", "keep", "missing"}, time.Now().Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, []models.RestoreResult{
+				{ShortURL: "restore", Status: models.RestoreStatusRestored},
+				{ShortURL: "keep", Status: models.RestoreStatusNotDeleted},
+				{ShortURL: "missing", Status: models.DeletionStatusNotFound},
+			}, results)
+			assert.NoError(t, s.GetOriginalURL(ctx, "restore").Error)
+
+			// Окно восстановления истекло.
+			results, err = s.RestoreURLs(ctx, "alice", []string{"purge"}, time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, models.RestoreStatusWindowExpired, results[0].Status)
+
+			purged, err := s.PurgeDeletedURLs(ctx, time.Now().Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), purged)
+			assert.ErrorIs(t, s.GetOriginalURL(ctx, "purge").Error, ErrNotFound)
+			assert.NoError(t, s.GetOriginalURL(ctx, "keep").Error)
+		})
+	}
+}
+
+func TestFileStoragePurgeCompactsFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	assert.NoError(t, err)
+
+	for _, shortURL := range []string{"first", "second"} {
+		assert.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{
+			ShortURL:    shortURL,
+			OriginalURL: "https://example.com/" + shortURL,
+			UserID:      "alice",
+		}))
+	}
+	assert.NoError(t, fs.SaveClicks(ctx, []models.ClickEvent{
+		{ShortURL: "first", ClickedAt: time.Now()},
+		{ShortURL: "second", ClickedAt: time.Now()},
+	}))
+	_, err = fs.MarkURLsAsDeleted(ctx, []models.URLToDelete{{UserID: "alice", ShortURL: "first"}})
+	assert.NoError(t, err)
+
+	purged, err := fs.PurgeDeletedURLs(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, reloaded.GetOriginalURL(ctx, "first").Error, ErrNotFound)
+	assert.NoError(t, reloaded.GetOriginalURL(ctx, "second").Error)
+
+	stats, err := reloaded.GetURLStats(ctx, "first")
+	assert.NoError(t, err)
+	assert.Zero(t, stats.TotalClicks)
+	stats, err = reloaded.GetURLStats(ctx, "second")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.TotalClicks)
+
+	// После очистки исходный URL снова можно сократить.
+	assert.NoError(t, reloaded.SaveURL(ctx, models.AddNewURLRecord{
+		ShortURL:    "third",
+		OriginalURL: "https://example.com/first",
+		UserID:      "alice",
+	}))
+}
+
+func TestFileStorageKeepsLegacyDeletedURLs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	// Записи, удалённые до появления deleted_at.
+	legacy := `{"correlation_id":"1","short_url":"old","original_url":"https://example.com/old","user_id":"alice","is_deleted":true}
+{"correlation_id":"2","short_url":"other","original_url":"https://example.com/other","user_id":"alice","is_deleted":false}
+{"correlation_id":"","short_url":"other","original_url":"","user_id":"","is_deleted":true,"op":"delete"}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(legacy), 0600))
+
+	fs, err := NewFileStorage(path, SyncAlways)
+	assert.NoError(t, err)
+	defer fs.Close()
+
+	// Окно восстановления отсчитывается с момента обновления, а не считается истёкшим.
+	purged, err := fs.PurgeDeletedURLs(ctx, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	results, err := fs.RestoreURLs(ctx, "alice", []string{"old", "other"}, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.RestoreResult{
+		{ShortURL: "old", Status: models.RestoreStatusRestored},
+		{ShortURL: "other", Status: models.RestoreStatusRestored},
+	}, results)
+}
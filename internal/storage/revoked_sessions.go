@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// revokedSessions — список отозванных сессий для хранилищ без БД. Запись нужна,
+// только пока не истекли выданные в сессии токены, после этого она удаляется.
+type revokedSessions struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+}
+
+func newRevokedSessions() *revokedSessions {
+	return &revokedSessions{sessions: make(map[string]time.Time)}
+}
+
+// add возвращает число удалённых заодно истёкших записей.
+func (s *revokedSessions) add(sessionID string, expiresAt, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := s.prune(now)
+	if expiresAt.After(now) && expiresAt.After(s.sessions[sessionID]) {
+		s.sessions[sessionID] = expiresAt
+	}
+	return pruned
+}
+
+func (s *revokedSessions) revoked(sessionID string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, exists := s.sessions[sessionID]
+	return exists && now.Before(expiresAt)
+}
+
+// prune вызывается под s.mu.
+func (s *revokedSessions) prune(now time.Time) int {
+	pruned := 0
+	for sessionID, expiresAt := range s.sessions {
+		if !now.Before(expiresAt) {
+			delete(s.sessions, sessionID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+func (s *revokedSessions) list() []revokedSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]revokedSession, 0, len(s.sessions))
+	for sessionID, expiresAt := range s.sessions {
+		result = append(result, revokedSession{SessionID: sessionID, ExpiresAt: expiresAt})
+	}
+	return result
+}
+
+// revokedSession — запись об отозванной сессии в файле.
+type revokedSession struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
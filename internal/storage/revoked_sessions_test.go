@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.RevokeSession(ctx, "logged-out", time.Now().Add(time.Hour)))
+			require.NoError(t, store.RevokeSession(ctx, "expired", time.Now().Add(-time.Second)))
+			// Повторный отзыв не укорачивает запись.
+			require.NoError(t, store.RevokeSession(ctx, "logged-out", time.Now().Add(time.Minute)))
+
+			revoked, err := store.IsSessionRevoked(ctx, "logged-out")
+			require.NoError(t, err)
+			assert.True(t, revoked)
+			revoked, err = store.IsSessionRevoked(ctx, "expired")
+			require.NoError(t, err)
+			assert.False(t, revoked)
+			revoked, err = store.IsSessionRevoked(ctx, "active")
+			require.NoError(t, err)
+			assert.False(t, revoked)
+		})
+	}
+}
+
+func TestFileStoragePersistsRevokedSessions(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	require.NoError(t, fs.RevokeSession(ctx, "short", time.Now().Add(50*time.Millisecond)))
+	require.NoError(t, fs.RevokeSession(ctx, "long", time.Now().Add(time.Hour)))
+	require.NoError(t, fs.Close())
+	time.Sleep(60 * time.Millisecond)
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer reloaded.Close()
+
+	revoked, err := reloaded.IsSessionRevoked(ctx, "long")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = reloaded.IsSessionRevoked(ctx, "short")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+	"time"
+)
+
+// SQLiteStorage повторяет семантику PostgresStorage для небольших инсталляций.
+// Время хранится в миллисекундах Unix, чтобы сравнения и индексы работали по числам.
+type SQLiteStorage struct {
+	db          *sql.DB
+	storageName string
+}
+
+func NewSQLiteStorage(db *sql.DB) *SQLiteStorage {
+	return &SQLiteStorage{
+		db:          db,
+		storageName: "sqlite storage",
+	}
+}
+
+func toMillis(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+func fromMillis(ms sql.NullInt64) *time.Time {
+	if !ms.Valid {
+		return nil
+	}
+	t := time.UnixMilli(ms.Int64).UTC()
+	return &t
+}
+
+func sqliteUniqueColumn(err error) (string, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return "", false
+	}
+	switch {
+	case strings.Contains(sqliteErr.Error(), "urls.short_url"):
+		return "short_url", true
+	case strings.Contains(sqliteErr.Error(), "urls.original_url"):
+		return "original_url", true
+	case strings.Contains(sqliteErr.Error(), "users.login"):
+		return "login", true
+	}
+	return "", false
+}
+
+type sqlQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertURL сводит нарушения уникальности к тем же ошибкам, что и остальные хранилища.
+func (s *SQLiteStorage) insertURL(ctx context.Context, q sqlQueryer, record models.AddNewURLRecord) error {
+	query := `
+		INSERT INTO urls (user_id, short_url, original_url, expires_at, redirect_type)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0));
+	`
+	_, err := q.ExecContext(ctx, query, record.UserID, record.ShortURL, record.OriginalURL, toMillis(record.ExpiresAt), record.RedirectType)
+	column, isUnique := sqliteUniqueColumn(err)
+	switch {
+	case err == nil:
+		return nil
+	case isUnique && column == "short_url":
+		return ErrShortURLTaken
+	case isUnique && column == "original_url":
+		var existing string
+		if err := q.QueryRowContext(ctx, "SELECT short_url FROM urls WHERE original_url = ?", record.OriginalURL).Scan(&existing); err != nil {
+			return err
+		}
+		return &ConflictError{ShortURL: existing}
+	default:
+		return err
+	}
+}
+
+func (s *SQLiteStorage) SaveURL(ctx context.Context, record models.AddNewURLRecord) error {
+	return s.insertURL(ctx, s.db, record)
+}
+
+func (s *SQLiteStorage) GetOriginalURL(ctx context.Context, shortURL string) models.OriginalURLSelectionResult {
+	var (
+		result       models.OriginalURLSelectionResult
+		expiresAt    sql.NullInt64
+		deletedAt    sql.NullInt64
+		redirectType sql.NullInt64
+		blockedAt    sql.NullInt64
+		blockReason  sql.NullString
+		threatType   sql.NullString
+	)
+	query := `
+		SELECT original_url, is_deleted, expires_at, deleted_at, user_id, redirect_type, blocked_at, block_reason, threat_type
+		FROM urls WHERE short_url = ?
+	`
+	err := s.db.QueryRowContext(ctx, query, shortURL).Scan(&result.OriginalURL, &result.IsDeleted, &expiresAt, &deletedAt,
+		&result.UserID, &redirectType, &blockedAt, &blockReason, &threatType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OriginalURLSelectionResult{Error: ErrNotFound}
+	}
+	if err != nil {
+		return models.OriginalURLSelectionResult{Error: err}
+	}
+	result.ExpiresAt = fromMillis(expiresAt)
+	result.DeletedAt = fromMillis(deletedAt)
+	result.RedirectType = int(redirectType.Int64)
+	result.BlockedAt = fromMillis(blockedAt)
+	result.BlockReason = blockReason.String
+	result.ThreatType = threatType.String
+	return withSelectionState(result, time.Now())
+}
+
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStorage) GetStorageName() (string, error) {
+	return s.storageName, nil
+}
+
+// SaveBatch сохраняет пакет в одной транзакции: уже сокращённые URL возвращаются
+// с существующим кодом, а при любой другой ошибке не сохраняется ничего.
+func (s *SQLiteStorage) SaveBatch(ctx context.Context, records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]models.BatchSaveResult, 0, len(records))
+	for _, record := range records {
+		result, err := batchSaveResult(record, s.insertURL(ctx, tx, record))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, tx.Commit()
+}
+
+func (s *SQLiteStorage) GetAllUserURLs(ctx context.Context, userID string) ([]models.BasePairsOfURLsResponse, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT short_url, original_url FROM urls WHERE user_id = ? AND is_deleted = 0", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]models.BasePairsOfURLsResponse, 0)
+	for rows.Next() {
+		var record models.BasePairsOfURLsResponse
+		if err := rows.Scan(&record.ShortURL, &record.OriginalURL); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLiteStorage) MarkURLsAsDeleted(ctx context.Context, urls []models.URLToDelete) ([]models.DeletionResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	results := make([]models.DeletionResult, 0, len(urls))
+	for _, item := range urls {
+		result := models.DeletionResult{UserID: item.UserID, ShortURL: item.ShortURL}
+
+		var owner string
+		err := tx.QueryRowContext(ctx, "SELECT user_id FROM urls WHERE short_url = ?", item.ShortURL).Scan(&owner)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result.Status = models.DeletionStatusNotFound
+		case err != nil:
+			return nil, err
+		case owner != item.UserID:
+			result.Status = models.DeletionStatusNotOwned
+		default:
+			query := "UPDATE urls SET is_deleted = 1, deleted_at = COALESCE(deleted_at, ?) WHERE short_url = ?"
+			if _, err := tx.ExecContext(ctx, query, now.UnixMilli(), item.ShortURL); err != nil {
+				return nil, err
+			}
+			result.Status = models.DeletionStatusDeleted
+		}
+		results = append(results, result)
+	}
+	return results, tx.Commit()
+}
+
+func (s *SQLiteStorage) MarkExpiredURLsAsDeleted(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+		UPDATE urls
+		SET is_deleted = 1, deleted_at = ?
+		WHERE expires_at <= ? AND is_deleted = 0;
+	`
+	res, err := s.db.ExecContext(ctx, query, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	results := make([]models.RestoreResult, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		var (
+			url       models.OriginalURLSelectionResult
+			expiresAt sql.NullInt64
+			deletedAt sql.NullInt64
+		)
+		query := "SELECT user_id, is_deleted, expires_at, deleted_at FROM urls WHERE short_url = ?"
+		err := tx.QueryRowContext(ctx, query, shortURL).Scan(&url.UserID, &url.IsDeleted, &expiresAt, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			results = append(results, models.RestoreResult{ShortURL: shortURL, Status: models.DeletionStatusNotFound})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		url.ExpiresAt = fromMillis(expiresAt)
+		url.DeletedAt = fromMillis(deletedAt)
+
+		status := restoreStatus(url, userID, deletedAfter, now)
+		if status == models.RestoreStatusRestored {
+			if _, err := tx.ExecContext(ctx, "UPDATE urls SET is_deleted = 0, deleted_at = NULL WHERE short_url = ?", shortURL); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, models.RestoreResult{ShortURL: shortURL, Status: status})
+	}
+	return results, tx.Commit()
+}
+
+func (s *SQLiteStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	purgeable := "is_deleted = 1 AND deleted_at < ?"
+	_, err = tx.ExecContext(ctx, "DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM urls WHERE "+purgeable+")", deletedBefore.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM urls WHERE "+purgeable, deletedBefore.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return purged, tx.Commit()
+}
+
+func (s *SQLiteStorage) SaveClicks(ctx context.Context, events []models.ClickEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, client_ip)
+		VALUES (?, ?, ?, ?, ?);
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if _, err := stmt.ExecContext(ctx, event.ShortURL, event.ClickedAt.UnixMilli(), event.Referrer, event.UserAgent, event.ClientIP); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) GetURLStats(ctx context.Context, shortURL string) (models.URLStats, error) {
+	stats := models.URLStats{
+		ShortURL: shortURL,
+		Days:     make([]models.DailyClicks, 0),
+	}
+
+	var lastClick sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*), MAX(clicked_at) FROM clicks WHERE short_url = ?", shortURL).
+		Scan(&stats.TotalClicks, &lastClick)
+	if err != nil {
+		return stats, err
+	}
+	stats.LastClickAt = fromMillis(lastClick)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT strftime('%Y-%m-%d', clicked_at / 1000, 'unixepoch') AS day, COUNT(*)
+		FROM clicks
+		WHERE short_url = ?
+		GROUP BY day
+		ORDER BY day;
+	`, shortURL)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day models.DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
+			return stats, err
+		}
+		stats.Days = append(stats.Days, day)
+	}
+	return stats, rows.Err()
+}
+
+func (s *SQLiteStorage) SaveDeletionTask(ctx context.Context, task models.DeletionTask) error {
+	shortURLs, err := json.Marshal(task.ShortURLs)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO deletion_tasks (id, user_id, short_urls, created_at) VALUES (?, ?, ?, ?)"
+	_, err = s.db.ExecContext(ctx, query, task.ID, task.UserID, string(shortURLs), task.CreatedAt.UnixMilli())
+	return err
+}
+
+func (s *SQLiteStorage) GetPendingDeletionTasks(ctx context.Context) ([]models.DeletionTask, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, user_id, short_urls, created_at FROM deletion_tasks ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.DeletionTask
+	for rows.Next() {
+		var (
+			task      models.DeletionTask
+			shortURLs string
+			createdAt int64
+		)
+		if err := rows.Scan(&task.ID, &task.UserID, &shortURLs, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(shortURLs), &task.ShortURLs); err != nil {
+			return nil, err
+		}
+		task.CreatedAt = time.UnixMilli(createdAt).UTC()
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *SQLiteStorage) RemoveDeletionTasks(ctx context.Context, ids []string) error {
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM deletion_tasks WHERE id IN (SELECT value FROM json_each(?))", string(encoded))
+	return err
+}
+
+func (s *SQLiteStorage) ReserveCodeIDs(ctx context.Context, n int) ([]int64, error) {
+	var last int64
+	err := s.db.QueryRowContext(ctx, "UPDATE code_counter SET value = value + ? WHERE id = 1 RETURNING value", n).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+	return codeIDRange(last-int64(n)+1, n), nil
+}
+
+func (s *SQLiteStorage) BlockURL(ctx context.Context, shortURL, reason string) error {
+	blockedAt := time.Now()
+	return s.updateURL(ctx, "UPDATE urls SET blocked_at = ?, block_reason = ? WHERE short_url = ?",
+		toMillis(&blockedAt), reason, shortURL)
+}
+
+func (s *SQLiteStorage) UnblockURL(ctx context.Context, shortURL string) error {
+	return s.updateURL(ctx, "UPDATE urls SET blocked_at = NULL, block_reason = NULL WHERE short_url = ?", shortURL)
+}
+
+// updateURL меняет одну ссылку и возвращает ErrNotFound, если такой ссылки нет.
+func (s *SQLiteStorage) updateURL(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) FlagURL(ctx context.Context, shortURL, threatType string) error {
+	return s.updateURL(ctx, "UPDATE urls SET threat_type = NULLIF(?, '') WHERE short_url = ?", threatType, shortURL)
+}
+
+func (s *SQLiteStorage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	query := "INSERT INTO api_keys (id, user_id, name, prefix, key_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := s.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.CreatedAt.UnixMilli())
+	return err
+}
+
+func (s *SQLiteStorage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	query := "SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at FROM api_keys WHERE key_hash = ?"
+	key, err := scanSQLiteAPIKey(s.db.QueryRowContext(ctx, query, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, err
+}
+
+func (s *SQLiteStorage) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	query := "SELECT id, user_id, name, prefix, key_hash, created_at, revoked_at FROM api_keys WHERE user_id = ? ORDER BY created_at"
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteStorage) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND user_id = ?"
+	result, err := s.db.ExecContext(ctx, query, time.Now().UnixMilli(), id, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanSQLiteAPIKey(row interface{ Scan(dest ...any) error }) (models.APIKey, error) {
+	var (
+		key       models.APIKey
+		createdAt int64
+		revokedAt sql.NullInt64
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &createdAt, &revokedAt); err != nil {
+		return models.APIKey{}, err
+	}
+	key.CreatedAt = time.UnixMilli(createdAt).UTC()
+	key.RevokedAt = fromMillis(revokedAt)
+	return key, nil
+}
+
+func (s *SQLiteStorage) RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Истёкшие записи больше ничего не защищают и удаляются заодно.
+	if _, err := tx.ExecContext(ctx, "DELETE FROM revoked_sessions WHERE expires_at <= ?", time.Now().UnixMilli()); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO revoked_sessions (session_id, expires_at) VALUES (?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET expires_at = MAX(revoked_sessions.expires_at, excluded.expires_at)
+	`
+	if _, err := tx.ExecContext(ctx, query, sessionID, expiresAt.UnixMilli()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	var revoked bool
+	query := "SELECT EXISTS (SELECT 1 FROM revoked_sessions WHERE session_id = ? AND expires_at > ?)"
+	err := s.db.QueryRowContext(ctx, query, sessionID, time.Now().UnixMilli()).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *SQLiteStorage) CreateUser(ctx context.Context, user models.User) error {
+	query := "INSERT INTO users (id, login, password_hash, created_at) VALUES (?, ?, ?, ?)"
+	_, err := s.db.ExecContext(ctx, query, user.ID, user.Login, user.PasswordHash, user.CreatedAt.UnixMilli())
+	if column, ok := sqliteUniqueColumn(err); ok && column == "login" {
+		return ErrLoginTaken
+	}
+	return err
+}
+
+func (s *SQLiteStorage) GetUser(ctx context.Context, id string) (models.User, error) {
+	return s.getUser(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE id = ?", id)
+}
+
+func (s *SQLiteStorage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	return s.getUser(ctx, "SELECT id, login, password_hash, created_at FROM users WHERE login = ?", login)
+}
+
+func (s *SQLiteStorage) getUser(ctx context.Context, query string, arg string) (models.User, error) {
+	var (
+		user      models.User
+		createdAt int64
+	)
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(&user.ID, &user.Login, &user.PasswordHash, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user.CreatedAt = time.UnixMilli(createdAt).UTC()
+	return user, nil
+}
+
+func (s *SQLiteStorage) ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE urls SET user_id = ? WHERE user_id = ?", toUserID, fromUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -1,15 +1,56 @@
 package storage
 
 import (
+	"context"
+	"github.com/AvdeevK/url-cutter.git/internal/config"
 	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"time"
 )
 
 type Storage interface {
-	SaveURL(shortURL, originalURL, userID string) (string, error)
-	GetOriginalURL(shortURL string) models.OriginalURLSelectionResult
-	Ping() error
-	SaveBatch([]models.AddNewURLRecord) error
+	SaveURL(context.Context, models.AddNewURLRecord) error
+	GetOriginalURL(context.Context, string) models.OriginalURLSelectionResult
+	// Ping проверяет соединение с базой. Хранилищам без внешней базы проверять нечего.
+	Ping(context.Context) error
+	SaveBatch(context.Context, []models.AddNewURLRecord) ([]models.BatchSaveResult, error)
 	GetStorageName() (string, error)
-	GetAllUserURLs(string) ([]models.BasePairsOfURLsResponse, error)
-	MarkURLsAsDeleted(string, []string) error
+	GetAllUserURLs(context.Context, string) ([]models.BasePairsOfURLsResponse, error)
+	MarkURLsAsDeleted(context.Context, []models.URLToDelete) ([]models.DeletionResult, error)
+	MarkExpiredURLsAsDeleted(context.Context, time.Time) (int64, error)
+	RestoreURLs(ctx context.Context, userID string, shortURLs []string, deletedAfter time.Time) ([]models.RestoreResult, error)
+	PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error)
+	SaveClicks(context.Context, []models.ClickEvent) error
+	GetURLStats(context.Context, string) (models.URLStats, error)
+	SaveDeletionTask(context.Context, models.DeletionTask) error
+	GetPendingDeletionTasks(context.Context) ([]models.DeletionTask, error)
+	RemoveDeletionTasks(context.Context, []string) error
+	// BlockURL запрещает переход по ссылке, UnblockURL снимает запрет.
+	BlockURL(ctx context.Context, shortURL, reason string) error
+	UnblockURL(ctx context.Context, shortURL string) error
+	// FlagURL помечает ссылку как опасную, пустой threatType снимает пометку.
+	FlagURL(ctx context.Context, shortURL, threatType string) error
+	SaveAPIKey(ctx context.Context, key models.APIKey) error
+	// GetAPIKey ищет ключ по хэшу, в том числе отозванный.
+	GetAPIKey(ctx context.Context, hash string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	// CreateUser возвращает ErrLoginTaken, если логин уже занят.
+	CreateUser(ctx context.Context, user models.User) error
+	GetUser(ctx context.Context, id string) (models.User, error)
+	GetUserByLogin(ctx context.Context, login string) (models.User, error)
+	// ReassignURLs передаёт все ссылки пользователя fromUserID пользователю toUserID.
+	ReassignURLs(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	// RevokeSession запоминает отозванную сессию до expiresAt, когда истекут все её токены.
+	RevokeSession(ctx context.Context, sessionID string, expiresAt time.Time) error
+	IsSessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	// ReserveCodeIDs выдаёт n значений счётчика для последовательных коротких кодов.
+	ReserveCodeIDs(ctx context.Context, n int) ([]int64, error)
+}
+
+// OperationContext ограничивает одну операцию с хранилищем настроенным таймаутом.
+func OperationContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if config.Configs.StorageTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, config.Configs.StorageTimeout)
 }
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationContext(t *testing.T) {
+	defer func(timeout time.Duration) { config.Configs.StorageTimeout = timeout }(config.Configs.StorageTimeout)
+
+	config.Configs.StorageTimeout = 10 * time.Millisecond
+	ctx, cancel := OperationContext(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(10*time.Millisecond), deadline, 10*time.Millisecond)
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	// Таймаут не продлевает более ранний дедлайн запроса.
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelParent()
+	config.Configs.StorageTimeout = time.Hour
+	ctx, cancel = OperationContext(parent)
+	defer cancel()
+	parentDeadline, _ := parent.Deadline()
+	deadline, _ = ctx.Deadline()
+	assert.Equal(t, parentDeadline, deadline)
+
+	// Без таймаута операция ограничена только контекстом запроса.
+	config.Configs.StorageTimeout = 0
+	parent, cancelParent = context.WithCancel(context.Background())
+	ctx, cancel = OperationContext(parent)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+	cancelParent()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
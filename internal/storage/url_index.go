@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const urlShardCount = 32
+
+type urlShard struct {
+	mu   sync.RWMutex
+	urls map[string]models.OriginalURLSelectionResult
+}
+
+// urlIndex — потокобезопасный набор ссылок, разбитый на шарды по короткому коду,
+// чтобы чтение популярных ссылок не ждало записей в другие шарды.
+type urlIndex struct {
+	shards [urlShardCount]*urlShard
+
+	// insertMu сериализует вставки, чтобы проверка уникальности кода
+	// и исходного URL выполнялась атомарно с самой вставкой.
+	insertMu  sync.Mutex
+	originals map[string]string
+}
+
+func newURLIndex() *urlIndex {
+	index := &urlIndex{
+		originals: make(map[string]string),
+	}
+	for i := range index.shards {
+		index.shards[i] = &urlShard{urls: make(map[string]models.OriginalURLSelectionResult)}
+	}
+	return index
+}
+
+func (i *urlIndex) shard(shortURL string) *urlShard {
+	h := fnv.New32a()
+	h.Write([]byte(shortURL))
+	return i.shards[h.Sum32()%urlShardCount]
+}
+
+func (i *urlIndex) get(shortURL string) (models.OriginalURLSelectionResult, bool) {
+	shard := i.shard(shortURL)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	url, exists := shard.urls[shortURL]
+	return url, exists
+}
+
+func (i *urlIndex) insert(shortURL string, url models.OriginalURLSelectionResult) error {
+	i.insertMu.Lock()
+	defer i.insertMu.Unlock()
+
+	if existing, exists := i.originals[url.OriginalURL]; exists {
+		return &ConflictError{ShortURL: existing}
+	}
+
+	shard := i.shard(shortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.urls[shortURL]; exists {
+		return ErrShortURLTaken
+	}
+	backfillDeletedAt(&url, time.Now().UTC())
+	shard.urls[shortURL] = url
+	i.originals[url.OriginalURL] = shortURL
+	return nil
+}
+
+// insertBatch добавляет записи пакета. Если запись не удалось добавить не из-за
+// уже сокращённого URL, добавленные до неё записи удаляются: пакет сохраняется
+// целиком или никак, и повтор с новыми кодами не находит остатков прошлой попытки.
+func (i *urlIndex) insertBatch(records []models.AddNewURLRecord) ([]models.BatchSaveResult, error) {
+	results := make([]models.BatchSaveResult, 0, len(records))
+	for _, record := range records {
+		result, err := batchSaveResult(record, i.insert(record.ShortURL, selectionFromRecord(record)))
+		if err != nil {
+			i.removeInserted(results)
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// removeInserted откатывает записи, добавленные insertBatch.
+func (i *urlIndex) removeInserted(results []models.BatchSaveResult) {
+	for _, result := range results {
+		if !result.Existing {
+			i.remove(result.ShortURL)
+		}
+	}
+}
+
+func selectionFromRecord(record models.AddNewURLRecord) models.OriginalURLSelectionResult {
+	return models.OriginalURLSelectionResult{
+		OriginalURL:  record.OriginalURL,
+		IsDeleted:    record.DeletedFlag,
+		UserID:       record.UserID,
+		ExpiresAt:    record.ExpiresAt,
+		RedirectType: record.RedirectType,
+	}
+}
+
+// put перезаписывает ссылку без проверок, используется при восстановлении из файла.
+func (i *urlIndex) put(shortURL string, url models.OriginalURLSelectionResult) {
+	i.insertMu.Lock()
+	defer i.insertMu.Unlock()
+
+	shard := i.shard(shortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	backfillDeletedAt(&url, time.Now().UTC())
+	shard.urls[shortURL] = url
+	i.originals[url.OriginalURL] = shortURL
+}
+
+func (i *urlIndex) remove(shortURL string) {
+	i.insertMu.Lock()
+	defer i.insertMu.Unlock()
+
+	shard := i.shard(shortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if url, exists := shard.urls[shortURL]; exists {
+		delete(shard.urls, shortURL)
+		if i.originals[url.OriginalURL] == shortURL {
+			delete(i.originals, url.OriginalURL)
+		}
+	}
+}
+
+// update применяет fn к ссылке под блокировкой её шарда и сохраняет результат, если fn вернула true.
+func (i *urlIndex) update(shortURL string, fn func(url *models.OriginalURLSelectionResult) bool) bool {
+	shard := i.shard(shortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	url, exists := shard.urls[shortURL]
+	if !exists || !fn(&url) {
+		return false
+	}
+	backfillDeletedAt(&url, time.Now().UTC())
+	shard.urls[shortURL] = url
+	return true
+}
+
+// setBlock блокирует ссылку или, при blockedAt == nil, снимает блокировку.
+func (i *urlIndex) setBlock(shortURL string, blockedAt *time.Time, reason string) bool {
+	return i.update(shortURL, func(url *models.OriginalURLSelectionResult) bool {
+		url.BlockedAt = blockedAt
+		url.BlockReason = reason
+		return true
+	})
+}
+
+func (i *urlIndex) setThreat(shortURL, threatType string) bool {
+	return i.update(shortURL, func(url *models.OriginalURLSelectionResult) bool {
+		url.ThreatType = threatType
+		return true
+	})
+}
+
+// updateAll проходит по всем шардам по очереди, не блокируя индекс целиком.
+func (i *urlIndex) updateAll(fn func(shortURL string, url *models.OriginalURLSelectionResult) bool) int64 {
+	var updated int64
+	for _, shard := range i.shards {
+		shard.mu.Lock()
+		for shortURL, url := range shard.urls {
+			if fn(shortURL, &url) {
+				shard.urls[shortURL] = url
+				updated++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return updated
+}
+
+func (i *urlIndex) len() int {
+	count := 0
+	for _, shard := range i.shards {
+		shard.mu.RLock()
+		count += len(shard.urls)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+func (i *urlIndex) forEach(fn func(shortURL string, url models.OriginalURLSelectionResult)) {
+	for _, shard := range i.shards {
+		shard.mu.RLock()
+		for shortURL, url := range shard.urls {
+			fn(shortURL, url)
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+func (i *urlIndex) selection(shortURL string, now time.Time) models.OriginalURLSelectionResult {
+	url, exists := i.get(shortURL)
+	if !exists {
+		return models.OriginalURLSelectionResult{
+			OriginalURL: "",
+			IsDeleted:   false,
+			Error:       ErrNotFound,
+			UserID:      "",
+		}
+	}
+	return withSelectionState(url, now)
+}
+
+func (i *urlIndex) userURLs(userID string) []models.BasePairsOfURLsResponse {
+	result := make([]models.BasePairsOfURLsResponse, 0)
+	i.forEach(func(shortURL string, url models.OriginalURLSelectionResult) {
+		if url.UserID == userID && !url.IsDeleted {
+			result = append(result, models.BasePairsOfURLsResponse{
+				OriginalURL: url.OriginalURL,
+				ShortURL:    shortURL,
+			})
+		}
+	})
+	return result
+}
+
+func (i *urlIndex) markDeleted(urls []models.URLToDelete, now time.Time) []models.DeletionResult {
+	results := make([]models.DeletionResult, 0, len(urls))
+	for _, item := range urls {
+		status := models.DeletionStatusNotFound
+		i.update(item.ShortURL, func(url *models.OriginalURLSelectionResult) bool {
+			if url.UserID != item.UserID {
+				status = models.DeletionStatusNotOwned
+				return false
+			}
+			status = models.DeletionStatusDeleted
+			if !url.IsDeleted {
+				url.IsDeleted = true
+				url.DeletedAt = &now
+			}
+			return true
+		})
+		results = append(results, models.DeletionResult{
+			UserID:   item.UserID,
+			ShortURL: item.ShortURL,
+			Status:   status,
+		})
+	}
+	return results
+}
+
+// markExpired помечает просроченные ссылки удалёнными и возвращает их коды.
+func (i *urlIndex) markExpired(now time.Time) []string {
+	marked := make([]string, 0)
+	i.updateAll(func(shortURL string, url *models.OriginalURLSelectionResult) bool {
+		if url.IsDeleted || url.ExpiresAt == nil || now.Before(*url.ExpiresAt) {
+			return false
+		}
+		url.IsDeleted = true
+		url.DeletedAt = &now
+		marked = append(marked, shortURL)
+		return true
+	})
+	return marked
+}
+
+// reassign передаёт ссылки другому пользователю и возвращает их коды.
+func (i *urlIndex) reassign(fromUserID, toUserID string) []string {
+	moved := make([]string, 0)
+	i.updateAll(func(shortURL string, url *models.OriginalURLSelectionResult) bool {
+		if url.UserID != fromUserID {
+			return false
+		}
+		url.UserID = toUserID
+		moved = append(moved, shortURL)
+		return true
+	})
+	return moved
+}
+
+// restore снимает пометку об удалении со ссылок пользователя, удалённых не раньше deletedAfter.
+func (i *urlIndex) restore(userID string, shortURLs []string, deletedAfter, now time.Time) []models.RestoreResult {
+	results := make([]models.RestoreResult, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		status := models.DeletionStatusNotFound
+		i.update(shortURL, func(url *models.OriginalURLSelectionResult) bool {
+			status = restoreStatus(*url, userID, deletedAfter, now)
+			if status != models.RestoreStatusRestored {
+				return false
+			}
+			url.IsDeleted = false
+			url.DeletedAt = nil
+			return true
+		})
+		results = append(results, models.RestoreResult{ShortURL: shortURL, Status: status})
+	}
+	return results
+}
+
+// purge физически удаляет ссылки, помеченные удалёнными раньше deletedBefore,
+// и возвращает их коды.
+func (i *urlIndex) purge(deletedBefore time.Time) []string {
+	i.insertMu.Lock()
+	defer i.insertMu.Unlock()
+
+	purged := make([]string, 0)
+	for _, shard := range i.shards {
+		shard.mu.Lock()
+		for shortURL, url := range shard.urls {
+			if !isPurgeable(url, deletedBefore) {
+				continue
+			}
+			delete(shard.urls, shortURL)
+			if i.originals[url.OriginalURL] == shortURL {
+				delete(i.originals, url.OriginalURL)
+			}
+			purged = append(purged, shortURL)
+		}
+		shard.mu.Unlock()
+	}
+	return purged
+}
+
+func restoreStatus(url models.OriginalURLSelectionResult, userID string, deletedAfter, now time.Time) string {
+	switch {
+	case url.UserID != userID:
+		return models.DeletionStatusNotOwned
+	case !url.IsDeleted:
+		return models.RestoreStatusNotDeleted
+	case url.ExpiresAt != nil && !now.Before(*url.ExpiresAt):
+		return models.RestoreStatusExpired
+	case url.DeletedAt == nil || url.DeletedAt.Before(deletedAfter):
+		return models.RestoreStatusWindowExpired
+	default:
+		return models.RestoreStatusRestored
+	}
+}
+
+func isPurgeable(url models.OriginalURLSelectionResult, deletedBefore time.Time) bool {
+	return url.IsDeleted && url.DeletedAt != nil && url.DeletedAt.Before(deletedBefore)
+}
+
+// backfillDeletedAt начинает окно восстановления для ссылок, удалённых до появления
+// deleted_at: считать их давно удалёнными значило бы стереть их при первой очистке.
+func backfillDeletedAt(url *models.OriginalURLSelectionResult, now time.Time) {
+	if url.IsDeleted && url.DeletedAt == nil {
+		url.DeletedAt = &now
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"sync"
+	"time"
+)
+
+// users хранит зарегистрированных пользователей для хранилищ без БД.
+type users struct {
+	mu      sync.RWMutex
+	byID    map[string]models.User
+	byLogin map[string]models.User
+}
+
+func newUsers() *users {
+	return &users{
+		byID:    make(map[string]models.User),
+		byLogin: make(map[string]models.User),
+	}
+}
+
+func (u *users) add(user models.User) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, exists := u.byLogin[user.Login]; exists {
+		return false
+	}
+	u.byID[user.ID] = user
+	u.byLogin[user.Login] = user
+	return true
+}
+
+func (u *users) get(id string) (models.User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	user, exists := u.byID[id]
+	return user, exists
+}
+
+func (u *users) getByLogin(login string) (models.User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	user, exists := u.byLogin[login]
+	return user, exists
+}
+
+// fileUser — запись пользователя в файле: в отличие от ответа API, в ней
+// сохраняется хэш пароля.
+type fileUser struct {
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
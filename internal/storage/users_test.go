@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AvdeevK/url-cutter.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageUsers(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			user := models.User{
+				ID:           "account",
+				Login:        "alice",
+				PasswordHash: "hash",
+				CreatedAt:    time.Now().UTC().Truncate(time.Millisecond),
+			}
+			require.NoError(t, store.CreateUser(ctx, user))
+			assert.ErrorIs(t, store.CreateUser(ctx, models.User{ID: "other", Login: "alice", PasswordHash: "hash"}), ErrLoginTaken)
+
+			found, err := store.GetUserByLogin(ctx, "alice")
+			require.NoError(t, err)
+			assert.Equal(t, "account", found.ID)
+			assert.Equal(t, "hash", found.PasswordHash)
+			found, err = store.GetUser(ctx, "account")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", found.Login)
+			_, err = store.GetUser(ctx, "other")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = store.GetUserByLogin(ctx, "bob")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestStorageReassignsURLs(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range newTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, record := range []models.AddNewURLRecord{
+				{ShortURL: "anon1", OriginalURL: "https://example.com/1", UserID: "anonymous"},
+				{ShortURL: "anon2", OriginalURL: "https://example.com/2", UserID: "anonymous"},
+				{ShortURL: "other", OriginalURL: "https://example.com/3", UserID: "someone"},
+			} {
+				require.NoError(t, store.SaveURL(ctx, record))
+			}
+
+			moved, err := store.ReassignURLs(ctx, "anonymous", "account")
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, moved)
+
+			urls, err := store.GetAllUserURLs(ctx, "account")
+			require.NoError(t, err)
+			assert.Len(t, urls, 2)
+			urls, err = store.GetAllUserURLs(ctx, "anonymous")
+			require.NoError(t, err)
+			assert.Empty(t, urls)
+			assert.Equal(t, "account", store.GetOriginalURL(ctx, "anon1").UserID)
+			assert.Equal(t, "someone", store.GetOriginalURL(ctx, "other").UserID)
+		})
+	}
+}
+
+func TestFileStoragePersistsUsersAndOwners(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.json")
+	fs, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+
+	require.NoError(t, fs.CreateUser(ctx, models.User{ID: "account", Login: "alice", PasswordHash: "hash"}))
+	require.NoError(t, fs.SaveURL(ctx, models.AddNewURLRecord{ShortURL: "anon", OriginalURL: "https://example.com/", UserID: "anonymous"}))
+	_, err = fs.ReassignURLs(ctx, "anonymous", "account")
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	reloaded, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	user, err := reloaded.GetUserByLogin(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.PasswordHash)
+	assert.Equal(t, "account", reloaded.GetOriginalURL(ctx, "anon").UserID)
+
+	// Владелец переживает компактизацию журнала.
+	require.NoError(t, reloaded.Compact())
+	require.NoError(t, reloaded.Close())
+	compacted, err := NewFileStorage(path, SyncAlways)
+	require.NoError(t, err)
+	defer compacted.Close()
+	assert.Equal(t, "account", compacted.GetOriginalURL(ctx, "anon").UserID)
+}
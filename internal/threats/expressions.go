@@ -0,0 +1,121 @@
+package threats
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxHostSuffixes = 5
+	maxDirPrefixes  = 4
+)
+
+// expressions строит выражения «хост/путь» для проверки URL, как это делает
+// Safe Browsing: до пяти суффиксов хоста и до шести вариантов пути.
+func expressions(rawURL string) ([]string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := canonicalHost(parsed.Hostname())
+	if host == "" {
+		return nil, nil
+	}
+	path := canonicalPath(parsed.EscapedPath())
+
+	var result []string
+	for _, h := range hostSuffixes(host) {
+		for _, p := range pathPrefixes(path, parsed.RawQuery) {
+			result = append(result, h+p)
+		}
+	}
+	return result, nil
+}
+
+func canonicalHost(host string) string {
+	host = strings.ToLower(strings.Trim(host, "."))
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+	return host
+}
+
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	cleaned := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		switch {
+		case segment == ".":
+			continue
+		case segment == "..":
+			if len(cleaned) > 1 {
+				cleaned = cleaned[:len(cleaned)-1]
+			}
+		case segment == "" && i != 0 && i != len(segments)-1:
+			continue
+		default:
+			cleaned = append(cleaned, segment)
+		}
+	}
+	path = strings.Join(cleaned, "/")
+	if strings.HasSuffix(segments[len(segments)-1], ".") && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// hostSuffixes возвращает сам хост и суффиксы из последних пяти компонентов,
+// отбрасывая компоненты слева. Доменная зона отдельно не проверяется, IP-адрес — только целиком.
+func hostSuffixes(host string) []string {
+	suffixes := []string{host}
+	if net.ParseIP(host) != nil {
+		return suffixes
+	}
+	components := strings.Split(host, ".")
+	start := len(components) - maxHostSuffixes
+	if start < 1 {
+		start = 1
+	}
+	for i := start; i < len(components)-1 && len(suffixes) < maxHostSuffixes; i++ {
+		suffixes = append(suffixes, strings.Join(components[i:], "."))
+	}
+	return suffixes
+}
+
+// pathPrefixes возвращает путь с запросом, путь без запроса и до четырёх
+// каталогов, начиная с корня.
+func pathPrefixes(path, query string) []string {
+	var prefixes []string
+	add := func(prefix string) {
+		for _, existing := range prefixes {
+			if existing == prefix {
+				return
+			}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	if query != "" {
+		add(path + "?" + query)
+	}
+	add(path)
+
+	dir := path[:strings.LastIndex(path, "/")+1]
+	prefix := "/"
+	add(prefix)
+	for i, component := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if component == "" || i >= maxDirPrefixes-1 {
+			break
+		}
+		prefix += component + "/"
+		add(prefix)
+	}
+	return prefixes
+}
@@ -0,0 +1,219 @@
+package threats
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/AvdeevK/url-cutter.git/internal/logger"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Формат файла повторяет ответ threatListUpdates:fetch из Safe Browsing v4:
+// поддерживаются только полные обновления с несжатыми префиксами.
+type updateFile struct {
+	ListUpdateResponses []listUpdate `json:"listUpdateResponses"`
+}
+
+type listUpdate struct {
+	ThreatType   string `json:"threatType"`
+	ResponseType string `json:"responseType"`
+	Additions    []struct {
+		CompressionType string `json:"compressionType"`
+		RawHashes       struct {
+			PrefixSize int    `json:"prefixSize"`
+			RawHashes  []byte `json:"rawHashes"`
+		} `json:"rawHashes"`
+	} `json:"additions"`
+	Checksum struct {
+		SHA256 []byte `json:"sha256"`
+	} `json:"checksum"`
+}
+
+// hashSet хранит префиксы SHA-256 по длине: ключ — префикс, значение — тип угрозы.
+// Префиксы длиной sha256.Size — это полные хэши.
+type hashSet map[int]map[string]string
+
+// Match — результат проверки адреса по списку.
+type Match struct {
+	ThreatType string
+	// Confirmed означает совпадение полного хэша. Совпадение короткого префикса
+	// только повод для проверки: в настоящем списке миллионы 4-байтовых префиксов,
+	// и заметная доля чистых адресов совпадёт с каким-нибудь из них.
+	Confirmed bool
+}
+
+// parseList читает список угроз. Полные хэши записываются в тот же формат
+// с prefixSize 32, например из ответа fullHashes:find.
+func parseList(r io.Reader) (hashSet, error) {
+	var file updateFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	set := make(hashSet)
+	for _, update := range file.ListUpdateResponses {
+		if update.ResponseType != "" && update.ResponseType != "FULL_UPDATE" {
+			return nil, fmt.Errorf("%s: unsupported response type %q", update.ThreatType, update.ResponseType)
+		}
+		var prefixes []string
+		for _, addition := range update.Additions {
+			if addition.CompressionType != "" && addition.CompressionType != "RAW" {
+				return nil, fmt.Errorf("%s: unsupported compression %q", update.ThreatType, addition.CompressionType)
+			}
+			size := addition.RawHashes.PrefixSize
+			raw := addition.RawHashes.RawHashes
+			if size < 4 || size > sha256.Size || len(raw)%size != 0 {
+				return nil, fmt.Errorf("%s: invalid prefix size %d", update.ThreatType, size)
+			}
+			if set[size] == nil {
+				set[size] = make(map[string]string)
+			}
+			for i := 0; i < len(raw); i += size {
+				prefix := string(raw[i : i+size])
+				set[size][prefix] = update.ThreatType
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		if len(update.Checksum.SHA256) > 0 && !bytes.Equal(update.Checksum.SHA256, checksum(prefixes)) {
+			return nil, fmt.Errorf("%s: checksum mismatch", update.ThreatType)
+		}
+	}
+	return set, nil
+}
+
+// checksum считается, как в Safe Browsing: SHA-256 от отсортированных префиксов.
+func checksum(prefixes []string) []byte {
+	sort.Strings(prefixes)
+	h := sha256.New()
+	for _, prefix := range prefixes {
+		h.Write([]byte(prefix))
+	}
+	return h.Sum(nil)
+}
+
+// match ищет сначала полный хэш любого из выражений адреса и только потом префиксы.
+func (s hashSet) match(rawURL string) (Match, bool) {
+	exprs, err := expressions(rawURL)
+	if err != nil {
+		return Match{}, false
+	}
+	var (
+		prefixMatch Match
+		found       bool
+	)
+	for _, expr := range exprs {
+		hash := sha256.Sum256([]byte(expr))
+		if threatType, exists := s[sha256.Size][string(hash[:])]; exists {
+			return Match{ThreatType: threatType, Confirmed: true}, true
+		}
+		if found {
+			continue
+		}
+		for size, prefixes := range s {
+			if threatType, exists := prefixes[string(hash[:size])]; exists && size < sha256.Size {
+				prefixMatch = Match{ThreatType: threatType}
+				found = true
+				break
+			}
+		}
+	}
+	return prefixMatch, found
+}
+
+// Scanner держит список угроз в памяти и подменяет его целиком при перечитывании файла.
+type Scanner struct {
+	set atomic.Pointer[hashSet]
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+}
+
+// New возвращает сканер с пустым списком.
+func New() *Scanner {
+	s := &Scanner{}
+	s.set.Store(&hashSet{})
+	return s
+}
+
+func Load(path string) (*Scanner, error) {
+	s := New()
+	s.path = path
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload перечитывает файл списка. При ошибке остаётся прежний список.
+func (s *Scanner) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		return nil
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	set, err := parseList(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.set.Store(&set)
+	return nil
+}
+
+// Watch перечитывает список, когда файл обновляется синхронизацией, пока не будет отменён ctx.
+func (s *Scanner) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				logger.Log.Error("failed to reload threat list", zap.Error(err))
+				continue
+			}
+			logger.Log.Info("threat list reloaded", zap.String("path", s.path))
+		}
+	}
+}
+
+func (s *Scanner) changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" {
+		return false
+	}
+	info, err := os.Stat(s.path)
+	return err == nil && !info.ModTime().Equal(s.modTime)
+}
+
+// Check сообщает, попадает ли URL в список, и подтверждено ли попадание полным хэшем.
+func (s *Scanner) Check(rawURL string) (Match, bool) {
+	return s.set.Load().match(rawURL)
+}
@@ -0,0 +1,132 @@
+package threats
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressions(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected []string
+	}{
+		{
+			url: "http://a.b.c/1/2.html?param=1",
+			expected: []string{
+				"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+				"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+			},
+		},
+		{
+			url: "http://a.b.c.d.e.f.g/1.html",
+			expected: []string{
+				"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+				"c.d.e.f.g/1.html", "c.d.e.f.g/",
+				"d.e.f.g/1.html", "d.e.f.g/",
+				"e.f.g/1.html", "e.f.g/",
+				"f.g/1.html", "f.g/",
+			},
+		},
+		{
+			url:      "http://1.2.3.4/1/",
+			expected: []string{"1.2.3.4/1/", "1.2.3.4/"},
+		},
+		{
+			url:      "http://EXAMPLE.com./a/./b/../c",
+			expected: []string{"example.com/a/c", "example.com/", "example.com/a/"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			exprs, err := expressions(tc.url)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, exprs)
+		})
+	}
+}
+
+// writeList сохраняет список угроз из префиксов хэшей выражений длиной size.
+func writeList(t *testing.T, path, threatType string, size int, exprs ...string) {
+	var raw []byte
+	var prefixes []string
+	for _, expr := range exprs {
+		hash := sha256.Sum256([]byte(expr))
+		raw = append(raw, hash[:size]...)
+		prefixes = append(prefixes, string(hash[:size]))
+	}
+	update := map[string]any{
+		"threatType":   threatType,
+		"responseType": "FULL_UPDATE",
+		"additions": []any{map[string]any{
+			"compressionType": "RAW",
+			"rawHashes":       map[string]any{"prefixSize": size, "rawHashes": raw},
+		}},
+		"checksum": map[string]any{"sha256": checksum(prefixes)},
+	}
+	data, err := json.Marshal(map[string]any{"listUpdateResponses": []any{update}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestScanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "threats.json")
+	writeList(t, path, "MALWARE", sha256.Size, "evil.example/", "example.com/phishing/")
+
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	match, found := s.Check("https://download.evil.example/setup.exe")
+	assert.True(t, found)
+	assert.Equal(t, Match{ThreatType: "MALWARE", Confirmed: true}, match)
+	_, found = s.Check("https://example.com/phishing/login.html?next=1")
+	assert.True(t, found)
+	_, found = s.Check("https://example.com/about")
+	assert.False(t, found)
+
+	writeList(t, path, "SOCIAL_ENGINEERING", sha256.Size, "example.com/")
+	require.NoError(t, s.Reload())
+	match, found = s.Check("https://example.com/about")
+	assert.True(t, found)
+	assert.Equal(t, "SOCIAL_ENGINEERING", match.ThreatType)
+	_, found = s.Check("https://download.evil.example/setup.exe")
+	assert.False(t, found)
+}
+
+func TestScannerPrefixMatchIsUnverified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "threats.json")
+	writeList(t, path, "MALWARE", 4, "evil.example/")
+
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	// Совпадение короткого префикса может быть ложным и не подтверждает угрозу.
+	match, found := s.Check("https://download.evil.example/setup.exe")
+	assert.True(t, found)
+	assert.Equal(t, Match{ThreatType: "MALWARE"}, match)
+	_, found = s.Check("https://example.com/about")
+	assert.False(t, found)
+}
+
+func TestScannerRejectsCorruptedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "threats.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"listUpdateResponses":[{
+		"threatType":"MALWARE",
+		"additions":[{"rawHashes":{"prefixSize":4,"rawHashes":"AAAAAA=="}}],
+		"checksum":{"sha256":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}
+	}]}`), 0o644))
+	_, err := Load(path)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"listUpdateResponses":[{
+		"threatType":"MALWARE",
+		"responseType":"PARTIAL_UPDATE"
+	}]}`), 0o644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
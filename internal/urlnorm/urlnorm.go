@@ -0,0 +1,123 @@
+// Package urlnorm проверяет URL перед сокращением и приводит их к каноническому виду,
+// чтобы одна и та же ссылка, записанная по-разному, сохранялась один раз.
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidURL       = errors.New("invalid url")
+	ErrSchemeNotAllowed = errors.New("url scheme is not allowed")
+	ErrTooLong          = errors.New("url is too long")
+)
+
+var DefaultSchemes = []string{"http", "https"}
+
+const trackingParamPrefix = "utm_"
+
+var (
+	trackingParams = map[string]bool{"fbclid": true, "gclid": true, "yclid": true}
+	defaultPorts   = map[string]string{"http": "80", "https": "443"}
+)
+
+type Options struct {
+	// AllowedSchemes — допустимые схемы в нижнем регистре; пустой список означает DefaultSchemes.
+	AllowedSchemes []string
+	// StripTracking удаляет из запроса utm_* и идентификаторы кликов рекламных систем.
+	StripTracking bool
+	// MaxLength ограничивает длину URL до и после нормализации; 0 снимает ограничение.
+	MaxLength int
+}
+
+// Normalize возвращает канонический вид URL: схема и хост в нижнем регистре,
+// IDN-хост в punycode, без порта по умолчанию, с путём «/» вместо пустого
+// и, если включено, без трекинговых параметров.
+func Normalize(raw string, opts Options) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: empty", ErrInvalidURL)
+	}
+	if opts.MaxLength > 0 && len(raw) > opts.MaxLength {
+		return "", ErrTooLong
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if !schemeAllowed(u.Scheme, opts.AllowedSchemes) {
+		return "", fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6-адрес без порта всё равно записывается в квадратных скобках.
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if opts.StripTracking {
+		u.RawQuery = stripTracking(u.RawQuery)
+	}
+	u.ForceQuery = false
+
+	normalized := u.String()
+	if opts.MaxLength > 0 && len(normalized) > opts.MaxLength {
+		return "", ErrTooLong
+	}
+	return normalized, nil
+}
+
+func schemeAllowed(scheme string, allowed []string) bool {
+	if len(allowed) == 0 {
+		allowed = DefaultSchemes
+	}
+	for _, s := range allowed {
+		if scheme == s {
+			return true
+		}
+	}
+	return false
+}
+
+// stripTracking сохраняет порядок остальных параметров и их исходное кодирование.
+func stripTracking(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	kept := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, trackingParamPrefix) || trackingParams[name] {
+				continue
+			}
+		}
+		if pair != "" {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
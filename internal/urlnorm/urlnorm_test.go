@@ -0,0 +1,57 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	opts := Options{StripTracking: true, MaxLength: 64}
+
+	testCases := []struct {
+		name     string
+		raw      string
+		expected string
+		err      error
+	}{
+		{name: "host and scheme lowercased", raw: "HTTPS://Dzen.RU", expected: "https://dzen.ru/"},
+		{name: "path case preserved", raw: "https://dzen.ru/News/Today", expected: "https://dzen.ru/News/Today"},
+		{name: "default port stripped", raw: "http://dzen.ru:80/news", expected: "http://dzen.ru/news"},
+		{name: "custom port kept", raw: "https://dzen.ru:8443/news", expected: "https://dzen.ru:8443/news"},
+		{name: "idn converted to punycode", raw: "https://Пример.РФ/путь", expected: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "ipv6 host", raw: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "tracking params removed", raw: "https://dzen.ru/a?utm_source=x&id=1&UTM_medium=y&fbclid=z", expected: "https://dzen.ru/a?id=1"},
+		{name: "fragment kept", raw: "https://dzen.ru/a#top", expected: "https://dzen.ru/a#top"},
+		{name: "surrounding spaces trimmed", raw: "  https://dzen.ru/a  ", expected: "https://dzen.ru/a"},
+		{name: "not a url", raw: "not a url", err: ErrSchemeNotAllowed},
+		{name: "javascript scheme", raw: "javascript:alert(1)", err: ErrSchemeNotAllowed},
+		{name: "missing host", raw: "https:/dzen.ru", err: ErrInvalidURL},
+		{name: "empty", raw: " ", err: ErrInvalidURL},
+		{name: "too long", raw: "https://dzen.ru/" + string(make([]byte, 64)), err: ErrTooLong},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			normalized, err := Normalize(tc.raw, opts)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, normalized)
+		})
+	}
+}
+
+func TestNormalizeKeepsTrackingWhenDisabled(t *testing.T) {
+	normalized, err := Normalize("https://dzen.ru/a?utm_source=x", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dzen.ru/a?utm_source=x", normalized)
+
+	_, err = Normalize("ftp://dzen.ru/file", Options{})
+	assert.ErrorIs(t, err, ErrSchemeNotAllowed)
+	normalized, err = Normalize("ftp://dzen.ru/file", Options{AllowedSchemes: []string{"ftp"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "ftp://dzen.ru/file", normalized)
+}